@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Save       = "save"
+	Revert     = "revert"
+	Delete     = "delete"
+	Rename     = "rename"
+	ACLChange  = "acl.change"
+	Login      = "login"
+	Import     = "import"
+	Restore    = "restore"
+	UserCreate = "user.create"
+	Hold       = "moderation.hold"
+	Approve    = "moderation.approve"
+	Discard    = "moderation.discard"
+)
+
+// Entry is one line of the log. Hash covers every other field, PrevHash
+// included, so editing or dropping a line breaks the chain from there on.
+type Entry struct {
+	Sequence    int       `json:"sequence"`
+	Timestamp   time.Time `json:"timestamp"`
+	User        string    `json:"user"`
+	IP          string    `json:"ip"`
+	Action      string    `json:"action"`
+	Title       string    `json:"title,omitempty"`
+	OldRevision int       `json:"old_revision,omitempty"`
+	NewRevision int       `json:"new_revision,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	PrevHash    string    `json:"prev_hash"`
+	Hash        string    `json:"hash"`
+}
+
+type Filter struct {
+	User   string
+	Action string
+	Title  string
+	Since  time.Time
+}
+
+func (self Filter) matches(entry Entry) bool {
+	return (self.User == "" || entry.User == self.User) &&
+		(self.Action == "" || entry.Action == self.Action) &&
+		(self.Title == "" || strings.EqualFold(entry.Title, self.Title)) &&
+		(self.Since.IsZero() || !entry.Timestamp.Before(self.Since))
+}
+
+// Log appends entries to <root>/.audit/audit.jsonl. The file is only ever
+// opened for appending. Other processes, like wikictl, append to the same
+// file, so every append locks it and chains onto whatever entry is last.
+type Log struct {
+	Root string
+	Now  func() time.Time
+
+	mutex sync.Mutex
+}
+
+func NewLog(root string) *Log {
+	return &Log{Root: filepath.Join(root, ".audit"), Now: time.Now}
+}
+
+func (self *Log) file() string {
+	return filepath.Join(self.Root, "audit.jsonl")
+}
+
+func hash(entry Entry) (string, error) {
+	entry.Hash = ""
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (self *Log) read() ([]Entry, error) {
+	file, err := os.Open(self.file())
+	if errors.Is(err, os.ErrNotExist) {
+		return []Entry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("audit line %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// tail returns the last entry in file, or a zero Entry when there is none.
+func tail(file *os.File) (Entry, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return Entry{}, err
+	}
+	size := info.Size()
+	for chunk := int64(4096); ; chunk *= 2 {
+		offset := max(size-chunk, 0)
+		buffer := make([]byte, size-offset)
+		if _, err = file.ReadAt(buffer, offset); err != nil {
+			return Entry{}, err
+		}
+		buffer = bytes.TrimRight(buffer, "\n")
+		start := bytes.LastIndexByte(buffer, '\n')
+		if start < 0 && offset > 0 {
+			continue
+		}
+		var entry Entry
+		if len(buffer) == 0 {
+			return entry, nil
+		}
+		err = json.Unmarshal(buffer[start+1:], &entry)
+		return entry, err
+	}
+}
+
+func (self *Log) Append(entry Entry) (Entry, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if err := os.MkdirAll(self.Root, 0700); err != nil {
+		return entry, err
+	}
+	file, err := os.OpenFile(self.file(),
+		os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return entry, err
+	}
+	defer file.Close()
+	unlock, err := lock(file)
+	if err != nil {
+		return entry, err
+	}
+	defer unlock()
+	last, err := tail(file)
+	if err != nil {
+		return entry, fmt.Errorf("last audit entry: %w", err)
+	}
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = self.Now().UTC()
+	}
+	entry.Sequence = last.Sequence + 1
+	entry.PrevHash = last.Hash
+	sum, err := hash(entry)
+	if err != nil {
+		return entry, err
+	}
+	entry.Hash = sum
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return entry, err
+}
+
+// Load returns the entries matching filter, newest first.
+func (self *Log) Load(filter Filter, limit int) ([]Entry, error) {
+	self.mutex.Lock()
+	entries, err := self.read()
+	self.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	matched := []Entry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !filter.matches(entries[i]) {
+			continue
+		}
+		matched = append(matched, entries[i])
+		if limit > 0 && len(matched) == limit {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// Verify walks the chain and reports the first entry that does not follow
+// from the one before it.
+func (self *Log) Verify() error {
+	self.mutex.Lock()
+	entries, err := self.read()
+	self.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	previous := ""
+	for i, entry := range entries {
+		if entry.Sequence != i+1 {
+			return fmt.Errorf("audit entry %d has sequence %d", i+1,
+				entry.Sequence)
+		}
+		if entry.PrevHash != previous {
+			return fmt.Errorf("audit entry %d does not follow entry %d",
+				entry.Sequence, i)
+		}
+		sum, err := hash(entry)
+		if err != nil {
+			return err
+		}
+		if sum != entry.Hash {
+			return fmt.Errorf("audit entry %d has been altered",
+				entry.Sequence)
+		}
+		previous = entry.Hash
+	}
+	return nil
+}
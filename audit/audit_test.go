@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendChainsEntries(t *testing.T) {
+	root := t.TempDir()
+	log := NewLog(root)
+	first, err := log.Append(Entry{User: "alice", Action: Save, Title: "Home",
+		NewRevision: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, first.Sequence)
+	assert.Equal(t, "", first.PrevHash)
+
+	// A fresh Log picks the chain up from the file.
+	log = NewLog(root)
+	second, err := log.Append(Entry{User: "bob", Action: Revert,
+		Title: "Home", OldRevision: 1, NewRevision: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, second.Sequence)
+	assert.Equal(t, first.Hash, second.PrevHash)
+	assert.NoError(t, log.Verify())
+}
+
+func TestAppendFollowsOtherWriters(t *testing.T) {
+	root := t.TempDir()
+	server, wikictl := NewLog(root), NewLog(root)
+	for i := 0; i < 3; i++ {
+		_, err := server.Append(Entry{User: "alice", Action: Save,
+			Detail: strings.Repeat("x", 5000)})
+		assert.NoError(t, err)
+		entry, err := wikictl.Append(Entry{User: "root", Action: Import})
+		assert.NoError(t, err)
+		assert.Equal(t, 2*i+2, entry.Sequence)
+	}
+	assert.NoError(t, server.Verify())
+}
+
+func TestLoadFilters(t *testing.T) {
+	log := NewLog(t.TempDir())
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	log.Append(Entry{User: "alice", Action: Save, Title: "Home",
+		Timestamp: day})
+	log.Append(Entry{User: "bob", Action: Save, Title: "Other",
+		Timestamp: day.Add(48 * time.Hour)})
+	log.Append(Entry{User: "alice", Action: Revert, Title: "Other",
+		Timestamp: day.Add(72 * time.Hour)})
+
+	entries, err := log.Load(Filter{User: "alice"}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	// Newest first.
+	assert.Equal(t, Revert, entries[0].Action)
+
+	entries, _ = log.Load(Filter{Title: "other", Action: Save}, 0)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "bob", entries[0].User)
+
+	entries, _ = log.Load(Filter{Since: day.Add(24 * time.Hour)}, 1)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, 3, entries[0].Sequence)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	log := NewLog(t.TempDir())
+	log.Append(Entry{User: "alice", Action: Save, Title: "Home"})
+	log.Append(Entry{User: "alice", Action: Save, Title: "Home"})
+	assert.NoError(t, log.Verify())
+
+	content, err := os.ReadFile(log.file())
+	assert.NoError(t, err)
+	tampered := strings.Replace(string(content), "alice", "mallory", 1)
+	assert.NoError(t, os.WriteFile(log.file(), []byte(tampered), 0600))
+	assert.ErrorContains(t, log.Verify(), "entry 1 has been altered")
+
+	// Dropping a line breaks the chain as well.
+	lines := strings.SplitAfter(string(content), "\n")
+	assert.NoError(t, os.WriteFile(log.file(), []byte(lines[1]), 0600))
+	assert.Error(t, log.Verify())
+}
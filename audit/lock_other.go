@@ -0,0 +1,11 @@
+//go:build !unix
+
+package audit
+
+import "os"
+
+// lock is a no-op where flock is missing: appends are only serialised
+// within a process there, so run wikictl while the server is stopped.
+func lock(file *os.File) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package audit
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive lock on file that other processes honour, and
+// returns the function releasing it.
+func lock(file *os.File) (func(), error) {
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	}, nil
+}
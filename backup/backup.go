@@ -0,0 +1,434 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+const (
+	Format   = "wiki-backup"
+	Version  = 1
+	manifest = "manifest.json"
+)
+
+// UsersFile holds password hashes; it is only archived when asked for.
+// AuditFile is the slash-separated path of the audit log.
+const (
+	UsersFile = ".users.json"
+	AuditFile = ".audit/audit.jsonl"
+)
+
+// sidecarFiles and sidecarDirs are the parts of the doc root that are not
+// pages but belong in a backup.
+var (
+	sidecarFiles = []string{UsersFile, ".tags.json",
+		filepath.FromSlash(AuditFile)}
+	sidecarDirs = []string{"assets", "attachments", ".moderation"}
+)
+
+// MaxEntrySize and MaxArchiveSize bound what Read decompresses, per entry
+// and in total, so a small upload cannot expand without limit in memory.
+var (
+	MaxEntrySize   int64 = 64 << 20
+	MaxArchiveSize int64 = 1 << 30
+)
+
+var (
+	revisionRegex = regexp.MustCompile(
+		"^pages/([a-zA-Z0-9]+)/revisions/([0-9]{8})\\.json$")
+	currentRegex = regexp.MustCompile("^pages/([a-zA-Z0-9]+)/current\\.txt$")
+)
+
+type Manifest struct {
+	Format    string            `json:"format"`
+	Version   int               `json:"version"`
+	Created   time.Time         `json:"created"`
+	Backend   string            `json:"backend"`
+	Pages     int               `json:"pages"`
+	Revisions int               `json:"revisions"`
+	Checksums map[string]string `json:"checksums"`
+}
+
+type storedRevision struct {
+	Revision types.Revision `json:"revision"`
+	Source   []byte         `json:"source"`
+}
+
+// Page is everything a backup holds for one title. Current is nil for a
+// page that was deleted but still has history.
+type Page struct {
+	Title     string
+	Revisions []storedRevision
+	Current   []byte
+}
+
+// Archive is a backup read fully into memory and checked.
+type Archive struct {
+	Manifest Manifest
+	Pages    []Page
+	// Files are doc root files by slash-separated relative path.
+	Files  map[string][]byte
+	Config []byte
+}
+
+// Options says what a backup holds besides pages and the public sidecar
+// files. Archives that leave the host over HTTP should hold neither.
+type Options struct {
+	Backend string
+	// ConfigPath, when set, adds the config file and the secrets in it.
+	ConfigPath string
+	// Users adds the password hashes in UsersFile.
+	Users bool
+}
+
+type writer struct {
+	tar       *tar.Writer
+	checksums map[string]string
+	created   time.Time
+}
+
+func (self *writer) add(name string, content []byte) error {
+	err := self.tar.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(content)),
+		ModTime: self.created})
+	if err != nil {
+		return err
+	}
+	if _, err = self.tar.Write(content); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	self.checksums[name] = hex.EncodeToString(sum[:])
+	return nil
+}
+
+func revisionName(title string, number int) string {
+	return fmt.Sprintf("pages/%s/revisions/%08d.json", title, number)
+}
+
+// titles lists current pages and, where the backend can tell, deleted pages
+// that still have history.
+func titles(store storage.Storage) ([]string, error) {
+	current, err := store.Titles()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, title := range current {
+		seen[title] = true
+	}
+	recent, err := store.RecentChanges(0, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, revision := range recent {
+		seen[revision.Title] = true
+	}
+	all := []string{}
+	for title := range seen {
+		all = append(all, title)
+	}
+	sort.Strings(all)
+	return all, nil
+}
+
+// Write archives every revision and current page of store, the sidecar
+// files of docRoot and whatever else options asks for. Callers must keep
+// writers out for the duration to get a consistent snapshot.
+func Write(
+	store storage.Storage,
+	docRoot string,
+	options Options,
+	out io.Writer) (Manifest, error) {
+	compressed := gzip.NewWriter(out)
+	archive := &writer{
+		tar:       tar.NewWriter(compressed),
+		checksums: map[string]string{},
+		created:   time.Now().UTC()}
+	result := Manifest{Format: Format, Version: Version,
+		Created: archive.created, Backend: options.Backend}
+
+	all, err := titles(store)
+	if err != nil {
+		return result, err
+	}
+	for _, title := range all {
+		history, err := store.History(title)
+		if err != nil {
+			return result, err
+		}
+		for _, revision := range history {
+			page, err := store.Revision(title, revision.Number)
+			if err != nil {
+				return result, err
+			}
+			source, err := util.Source(page)
+			if err != nil {
+				return result, err
+			}
+			content, err := json.Marshal(storedRevision{Revision: revision,
+				Source: source})
+			if err != nil {
+				return result, err
+			}
+			err = archive.add(revisionName(title, revision.Number), content)
+			if err != nil {
+				return result, err
+			}
+			result.Revisions++
+		}
+		page, err := store.Load(title)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return result, err
+		}
+		source, err := util.Source(page)
+		if err != nil {
+			return result, err
+		}
+		if err = archive.add("pages/"+title+"/current.txt", source); err != nil {
+			return result, err
+		}
+		result.Pages++
+	}
+
+	if err = addFiles(archive, docRoot, options.Users); err != nil {
+		return result, err
+	}
+	if options.ConfigPath != "" {
+		content, err := os.ReadFile(options.ConfigPath)
+		if err != nil {
+			return result, err
+		}
+		if err = archive.add("config/settings.yaml", content); err != nil {
+			return result, err
+		}
+	}
+
+	result.Checksums = archive.checksums
+	content, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return result, err
+	}
+	if err = archive.tar.WriteHeader(&tar.Header{Name: manifest, Mode: 0600,
+		Size: int64(len(content)), ModTime: archive.created}); err != nil {
+		return result, err
+	}
+	if _, err = archive.tar.Write(content); err != nil {
+		return result, err
+	}
+	if err = archive.tar.Close(); err != nil {
+		return result, err
+	}
+	return result, compressed.Close()
+}
+
+func addFiles(archive *writer, docRoot string, users bool) error {
+	for _, name := range sidecarFiles {
+		if name == UsersFile && !users {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(docRoot, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err = archive.add("files/"+filepath.ToSlash(name),
+			content); err != nil {
+			return err
+		}
+	}
+	for _, dir := range sidecarDirs {
+		root := filepath.Join(docRoot, dir)
+		if !util.Exists(root) {
+			continue
+		}
+		err := filepath.WalkDir(root, func(file string, entry fs.DirEntry,
+			err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			relative, err := filepath.Rel(docRoot, file)
+			if err != nil {
+				return err
+			}
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			return archive.add("files/"+filepath.ToSlash(relative), content)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeFile only accepts the sidecar files a backup writes, so an archive
+// cannot overwrite pages, templates or anything outside the doc root.
+func safeFile(name string) bool {
+	clean := path.Clean(name)
+	if clean != name || path.IsAbs(clean) || clean == ".." ||
+		strings.HasPrefix(clean, "../") {
+		return false
+	}
+	for _, file := range sidecarFiles {
+		if clean == filepath.ToSlash(file) {
+			return true
+		}
+	}
+	for _, dir := range sidecarDirs {
+		if strings.HasPrefix(clean, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Read loads and validates a backup. Nothing in it is trusted until every
+// entry matches its checksum and each page's revisions run from 1 without
+// gaps.
+func Read(in io.Reader) (*Archive, error) {
+	decompressed, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzip archive: %w", err)
+	}
+	reader := tar.NewReader(decompressed)
+	entries := map[string][]byte{}
+	var total int64
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry %s", header.Name)
+		}
+		if _, ok := entries[header.Name]; ok {
+			return nil, fmt.Errorf("duplicate entry %s", header.Name)
+		}
+		total += header.Size
+		if header.Size > MaxEntrySize {
+			return nil, fmt.Errorf("entry %s is larger than %d bytes",
+				header.Name, MaxEntrySize)
+		} else if total > MaxArchiveSize {
+			return nil, fmt.Errorf("archive is larger than %d bytes",
+				MaxArchiveSize)
+		}
+		content, err := io.ReadAll(io.LimitReader(reader, header.Size))
+		if err != nil {
+			return nil, err
+		}
+		entries[header.Name] = content
+	}
+
+	content, ok := entries[manifest]
+	if !ok {
+		return nil, errors.New("archive has no manifest")
+	}
+	delete(entries, manifest)
+	archive := &Archive{Files: map[string][]byte{}}
+	if err = json.Unmarshal(content, &archive.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if archive.Manifest.Format != Format ||
+		archive.Manifest.Version != Version {
+		return nil, fmt.Errorf("unsupported backup format %s v%d",
+			archive.Manifest.Format, archive.Manifest.Version)
+	}
+	if len(archive.Manifest.Checksums) != len(entries) {
+		return nil, fmt.Errorf("manifest lists %d entries, archive has %d",
+			len(archive.Manifest.Checksums), len(entries))
+	}
+
+	pages := map[string]*Page{}
+	page := func(title string) *Page {
+		if pages[title] == nil {
+			pages[title] = &Page{Title: title}
+		}
+		return pages[title]
+	}
+	for name, content := range entries {
+		sum := sha256.Sum256(content)
+		if archive.Manifest.Checksums[name] != hex.EncodeToString(sum[:]) {
+			return nil, fmt.Errorf("checksum mismatch for %s", name)
+		}
+		if match := revisionRegex.FindStringSubmatch(name); match != nil {
+			var stored storedRevision
+			if err = json.Unmarshal(content, &stored); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			number, _ := strconv.Atoi(match[2])
+			if stored.Revision.Title != match[1] ||
+				stored.Revision.Number != number {
+				return nil, fmt.Errorf("%s records %s r%d", name,
+					stored.Revision.Title, stored.Revision.Number)
+			}
+			current := page(match[1])
+			current.Revisions = append(current.Revisions, stored)
+		} else if match := currentRegex.FindStringSubmatch(name); match != nil {
+			page(match[1]).Current = content
+		} else if name == "config/settings.yaml" {
+			archive.Config = content
+		} else if strings.HasPrefix(name, "files/") &&
+			safeFile(strings.TrimPrefix(name, "files/")) {
+			archive.Files[strings.TrimPrefix(name, "files/")] = content
+		} else {
+			return nil, fmt.Errorf("unexpected entry %s", name)
+		}
+	}
+
+	for _, title := range sortedTitles(pages) {
+		current := pages[title]
+		sort.Slice(current.Revisions, func(i, j int) bool {
+			return current.Revisions[i].Revision.Number <
+				current.Revisions[j].Revision.Number
+		})
+		for i, stored := range current.Revisions {
+			if stored.Revision.Number != i+1 {
+				return nil, fmt.Errorf("%s is missing revision %d", title,
+					i+1)
+			}
+		}
+		if current.Current == nil && len(current.Revisions) == 0 {
+			return nil, fmt.Errorf("%s has no content", title)
+		}
+		archive.Pages = append(archive.Pages, *current)
+	}
+	return archive, nil
+}
+
+func sortedTitles(pages map[string]*Page) []string {
+	titles := []string{}
+	for title := range pages {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+	return titles
+}
@@ -0,0 +1,209 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func save(t *testing.T, store storage.Storage, title string, body string) {
+	assert.NoError(t, store.Save(&types.Page{Title: title, Body: []byte(body)},
+		&types.Revision{Author: "a", Summary: body}))
+}
+
+func snapshot(t *testing.T, store storage.Storage, root string) []byte {
+	var buffer bytes.Buffer
+	_, err := Write(store, root, Options{Backend: "filesystem", Users: true},
+		&buffer)
+	assert.NoError(t, err)
+	return buffer.Bytes()
+}
+
+// rewrite copies an archive through change, which may alter or drop entries
+// by returning nil.
+func rewrite(t *testing.T, archive []byte,
+	change func(name string, content []byte) []byte) []byte {
+	reader, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.NoError(t, err)
+	entries := tar.NewReader(reader)
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(compressed)
+	for {
+		header, err := entries.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		content, err := io.ReadAll(entries)
+		assert.NoError(t, err)
+		if content = change(header.Name, content); content == nil {
+			continue
+		}
+		header.Size = int64(len(content))
+		assert.NoError(t, writer.WriteHeader(header))
+		_, err = writer.Write(content)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, compressed.Close())
+	return buffer.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewFilesystem(root)
+	save(t, store, "Home", "One.")
+	save(t, store, "Home", "Two.")
+	save(t, store, "Gone", "Soon gone.")
+	assert.NoError(t, store.Delete("Gone", &types.Revision{Author: "a"}))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "assets"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "assets", "wiki.css"),
+		[]byte("body {}"), 0600))
+
+	archive, err := Read(bytes.NewReader(snapshot(t, store, root)))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, archive.Manifest.Pages)
+	assert.Equal(t, 3, archive.Manifest.Revisions)
+	assert.Equal(t, "body {}", string(archive.Files["assets/wiki.css"]))
+
+	target := t.TempDir()
+	restored := storage.NewFilesystem(target)
+	report, err := Restore(restored, target, archive, Merge, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Gone", "Home"}, report.Created)
+	assert.Equal(t, 1, report.Files)
+
+	page, err := restored.Load("Home")
+	assert.NoError(t, err)
+	assert.Equal(t, "Two.", string(page.Body))
+	history, err := restored.History("Home")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "One.", history[0].Summary)
+	titles, err := restored.Titles()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Home"}, titles)
+	css, err := os.ReadFile(filepath.Join(target, "assets", "wiki.css"))
+	assert.NoError(t, err)
+	assert.Equal(t, "body {}", string(css))
+}
+
+func TestMergeAndReplace(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewFilesystem(root)
+	save(t, store, "Home", "Archived.")
+	archived := snapshot(t, store, root)
+	save(t, store, "Home", "Changed.")
+	save(t, store, "Extra", "Not archived.")
+
+	archive, err := Read(bytes.NewReader(archived))
+	assert.NoError(t, err)
+	report, err := Restore(store, root, archive, Merge, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Home"}, report.Skipped)
+	page, _ := store.Load("Home")
+	assert.Equal(t, "Changed.", string(page.Body))
+
+	archive.Files[AuditFile] = []byte("forged\n")
+	report, err = Restore(store, root, archive, Replace, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Home"}, report.Reverted)
+	audit, _ := os.ReadFile(filepath.Join(root, ".audit", "audit.jsonl"))
+	assert.NotEqual(t, "forged\n", string(audit))
+	assert.Equal(t, []string{"Extra"}, report.Deleted)
+	page, _ = store.Load("Home")
+	assert.Equal(t, "Archived.", string(page.Body))
+	history, _ := store.History("Home")
+	assert.Len(t, history, 3)
+
+	_, err = Restore(store, root, archive, "overwrite", "b")
+	assert.Error(t, err)
+}
+
+func TestReadRejectsInvalidArchives(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewFilesystem(root)
+	save(t, store, "Home", "One.")
+	save(t, store, "Home", "Two.")
+	archive := snapshot(t, store, root)
+
+	_, err := Read(bytes.NewReader([]byte("not gzip")))
+	assert.Error(t, err)
+
+	tampered := rewrite(t, archive, func(name string, content []byte) []byte {
+		if name == "pages/Home/current.txt" {
+			return []byte("Tampered.")
+		}
+		return content
+	})
+	_, err = Read(bytes.NewReader(tampered))
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	missing := rewrite(t, archive, func(name string, content []byte) []byte {
+		if name == manifest {
+			return nil
+		}
+		return content
+	})
+	_, err = Read(bytes.NewReader(missing))
+	assert.ErrorContains(t, err, "no manifest")
+
+	dropped := rewrite(t, archive, func(name string, content []byte) []byte {
+		if name == revisionName("Home", 1) {
+			return nil
+		}
+		return content
+	})
+	_, err = Read(bytes.NewReader(dropped))
+	assert.Error(t, err)
+
+	defer func(entry int64, total int64) {
+		MaxEntrySize, MaxArchiveSize = entry, total
+	}(MaxEntrySize, MaxArchiveSize)
+	MaxEntrySize = 4
+	_, err = Read(bytes.NewReader(archive))
+	assert.ErrorContains(t, err, "larger than 4 bytes")
+	MaxEntrySize, MaxArchiveSize = 1<<20, 16
+	_, err = Read(bytes.NewReader(archive))
+	assert.ErrorContains(t, err, "archive is larger than 16 bytes")
+
+	assert.False(t, safeFile("../settings.yaml"))
+	assert.False(t, safeFile("Home.txt"))
+	assert.False(t, safeFile("assets/../Home.txt"))
+	assert.True(t, safeFile("assets/wiki.css"))
+	assert.True(t, safeFile(".audit/audit.jsonl"))
+}
+
+func TestSchedulerRotates(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	scheduler := &Scheduler{Dir: dir, Retain: 2,
+		Snapshot: func(writer io.Writer) error {
+			_, err := writer.Write([]byte("archive"))
+			return err
+		},
+		Now: func() time.Time { return now }}
+	for i := 0; i < 3; i++ {
+		_, err := scheduler.RunOnce()
+		assert.NoError(t, err)
+		now = now.Add(time.Hour)
+	}
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"wiki-20240101T010000Z.tar.gz",
+		"wiki-20240101T020000Z.tar.gz"}, names)
+}
@@ -0,0 +1,169 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+const (
+	// Merge adds the pages and files the wiki lacks and leaves the rest.
+	Merge = "merge"
+	// Replace also brings existing pages back to their archived content,
+	// as new revisions, deletes pages the archive does not have and
+	// overwrites files.
+	Replace = "replace"
+)
+
+type RestoreReport struct {
+	Created   []string
+	Reverted  []string
+	Deleted   []string
+	Skipped   []string
+	Files     int
+	Revisions int
+}
+
+func parsePage(title string, source []byte) *types.Page {
+	meta, body, err := util.ParseFrontMatter(source)
+	if err != nil {
+		meta, body = nil, source
+	}
+	return &types.Page{Title: title, Body: body, Meta: meta}
+}
+
+// Restore writes archive into store and docRoot. Pages the store has no
+// history for get their full history replayed; what happens to the others
+// depends on mode. The archived audit log is never restored, since the
+// live one may only be appended to.
+func Restore(
+	store storage.Storage,
+	docRoot string,
+	archive *Archive,
+	mode string,
+	author string) (RestoreReport, error) {
+	report := RestoreReport{}
+	if mode != Merge && mode != Replace {
+		return report, fmt.Errorf("unknown restore mode %q", mode)
+	}
+	archived := map[string]bool{}
+	for _, page := range archive.Pages {
+		archived[page.Title] = true
+		history, err := store.History(page.Title)
+		if err != nil {
+			return report, err
+		}
+		if len(history) == 0 {
+			if err = replay(store, page, &report); err != nil {
+				return report, err
+			}
+			report.Created = append(report.Created, page.Title)
+			continue
+		}
+		if mode == Merge {
+			report.Skipped = append(report.Skipped, page.Title)
+			continue
+		}
+		reverted, err := revert(store, page, author)
+		if err != nil {
+			return report, err
+		}
+		if reverted {
+			report.Reverted = append(report.Reverted, page.Title)
+		}
+	}
+
+	if mode == Replace {
+		current, err := store.Titles()
+		if err != nil {
+			return report, err
+		}
+		for _, title := range current {
+			if archived[title] {
+				continue
+			}
+			err = store.Delete(title, &types.Revision{
+				Summary: "Not in restored backup", Author: author})
+			if err != nil {
+				return report, err
+			}
+			report.Deleted = append(report.Deleted, title)
+		}
+	}
+
+	for name, content := range archive.Files {
+		if name == AuditFile {
+			continue
+		}
+		target := filepath.Join(docRoot, filepath.FromSlash(name))
+		if mode == Merge && util.Exists(target) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return report, err
+		}
+		if err := os.WriteFile(target, content, 0600); err != nil {
+			return report, err
+		}
+		report.Files++
+	}
+	return report, nil
+}
+
+func replay(store storage.Storage, page Page, report *RestoreReport) error {
+	for _, stored := range page.Revisions {
+		revision := stored.Revision
+		err := store.Save(parsePage(page.Title, stored.Source), &revision)
+		if err != nil {
+			return err
+		}
+		report.Revisions++
+	}
+	if len(page.Revisions) == 0 {
+		err := store.Save(parsePage(page.Title, page.Current),
+			&types.Revision{Summary: "Restored from backup"})
+		if err != nil {
+			return err
+		}
+		report.Revisions++
+	} else if page.Current == nil {
+		return store.Delete(page.Title, &types.Revision{
+			Summary: "Deleted in restored backup"})
+	}
+	return nil
+}
+
+// revert saves the archived content of page over the store's when they
+// differ, or deletes the page when it was deleted in the archive.
+func revert(store storage.Storage, page Page, author string) (bool, error) {
+	existing, err := store.Load(page.Title)
+	if errors.Is(err, os.ErrNotExist) {
+		existing = nil
+	} else if err != nil {
+		return false, err
+	}
+	if page.Current == nil {
+		if existing == nil {
+			return false, nil
+		}
+		return true, store.Delete(page.Title, &types.Revision{
+			Summary: "Deleted in restored backup", Author: author})
+	}
+	if existing != nil {
+		source, err := util.Source(existing)
+		if err != nil {
+			return false, err
+		}
+		if bytes.Equal(source, page.Current) {
+			return false, nil
+		}
+	}
+	return true, store.Save(parsePage(page.Title, page.Current),
+		&types.Revision{Summary: "Restored from backup", Author: author})
+}
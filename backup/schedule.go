@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const archivePrefix = "wiki-"
+const archiveSuffix = ".tar.gz"
+
+// Scheduler writes an archive into Dir every Interval with Snapshot and
+// keeps the newest Retain archives.
+type Scheduler struct {
+	Dir      string
+	Interval time.Duration
+	Retain   int
+	Snapshot func(io.Writer) error
+	Now      func() time.Time
+}
+
+// RunOnce writes one archive and rotates. Archives are written under a
+// temporary name so a crash never leaves a truncated one to rotate in.
+func (self *Scheduler) RunOnce() (string, error) {
+	if err := os.MkdirAll(self.Dir, 0700); err != nil {
+		return "", err
+	}
+	name := archivePrefix + self.Now().UTC().Format("20060102T150405Z") +
+		archiveSuffix
+	target := filepath.Join(self.Dir, name)
+	file, err := os.CreateTemp(self.Dir, ".backup-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	if err = self.Snapshot(file); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err = file.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Rename(file.Name(), target); err != nil {
+		return "", err
+	}
+	return target, self.Rotate()
+}
+
+// Rotate removes all but the newest Retain archives. A Retain of zero or
+// less keeps everything.
+func (self *Scheduler) Rotate() error {
+	if self.Retain <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(self.Dir)
+	if err != nil {
+		return err
+	}
+	archives := []string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), archivePrefix) &&
+			strings.HasSuffix(entry.Name(), archiveSuffix) {
+			archives = append(archives, entry.Name())
+		}
+	}
+	// The timestamped names sort oldest first.
+	sort.Strings(archives)
+	for len(archives) > self.Retain {
+		if err = os.Remove(filepath.Join(self.Dir, archives[0])); err != nil {
+			return err
+		}
+		archives = archives[1:]
+	}
+	return nil
+}
+
+func (self *Scheduler) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(self.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if path, err := self.RunOnce(); err != nil {
+				slog.Error("scheduled backup failed", "error", err)
+			} else {
+				slog.Info("scheduled backup written", "path", path)
+			}
+		}
+	}
+}
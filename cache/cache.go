@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Capacity  int    `json:"capacity"`
+}
+
+// Entry is one rendered page. Links are the titles the page links to, so
+// creating one of them invalidates it, and Includes the titles it
+// transcludes, so saving one of them does. Generation is what Generation
+// returned before the render read anything.
+type Entry struct {
+	Revision   int
+	Generation uint64
+	Modified   time.Time
+	Links      []string
+	Includes   []string
+	Body       []byte
+}
+
+type item struct {
+	title  string
+	entry  Entry
+	stored time.Time
+}
+
+// maxChanges bounds how many invalidated titles are remembered. Renders
+// take moments, so only recent changes matter; forgetting an older one
+// raises the horizon instead, below which every render is dropped.
+const maxChanges = 4096
+
+// change is the newest revision and generation invalidated for a title.
+type change struct {
+	title      string
+	floor      int
+	generation uint64
+}
+
+// LRU holds rendered pages keyed by title and the revision they were
+// rendered from. Invalidate records the newest revision it has seen for a
+// title, so a render of an older revision that finishes late is dropped
+// instead of being cached. Pages a render links to or includes have no
+// revision in it, so every invalidation also moves a generation counter
+// and a render that started before one of them changed is dropped too.
+//
+// Invalidation only reaches the cache of the server that saved. When other
+// servers write to the same storage, TTL bounds how long a page they
+// changed is served from this one; zero keeps pages until invalidated.
+type LRU struct {
+	TTL time.Duration
+	Now func() time.Time
+
+	mutex      sync.Mutex
+	capacity   int
+	order      *list.List
+	items      map[string]*list.Element
+	generation uint64
+	horizon    uint64
+	history    *list.List
+	changes    map[string]*list.Element
+	stats      Stats
+}
+
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		Now:      time.Now,
+		capacity: capacity,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+		history:  list.New(),
+		changes:  map[string]*list.Element{}}
+}
+
+// Generation is taken before a render reads the pages it is made from and
+// stored in its Entry.
+func (self *LRU) Generation() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.generation
+}
+
+func (self *LRU) change(title string) *change {
+	if element, ok := self.changes[title]; ok {
+		return element.Value.(*change)
+	}
+	return &change{title: title}
+}
+
+// touch records that title changed, at revision when it is known.
+func (self *LRU) touch(title string, revision int) {
+	self.generation++
+	record := self.change(title)
+	record.generation = self.generation
+	if revision > record.floor {
+		record.floor = revision
+	}
+	if element, ok := self.changes[title]; ok {
+		self.history.MoveToFront(element)
+	} else {
+		self.changes[title] = self.history.PushFront(record)
+	}
+	for self.history.Len() > maxChanges {
+		oldest := self.history.Back()
+		self.history.Remove(oldest)
+		forgotten := oldest.Value.(*change)
+		delete(self.changes, forgotten.title)
+		self.horizon = forgotten.generation
+	}
+}
+
+// stale says whether entry for title is older than a change to it or to a
+// page it depends on.
+func (self *LRU) stale(title string, entry Entry) bool {
+	if entry.Generation < self.horizon ||
+		entry.Revision < self.change(title).floor {
+		return true
+	}
+	for _, titles := range [][]string{entry.Includes, entry.Links} {
+		for _, dependency := range titles {
+			if self.change(dependency).generation > entry.Generation {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (self *LRU) Get(title string) (Entry, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	element, ok := self.items[title]
+	if ok && self.TTL > 0 &&
+		self.Now().Sub(element.Value.(*item).stored) >= self.TTL {
+		self.remove(title)
+		ok = false
+	}
+	if !ok {
+		self.stats.Misses++
+		return Entry{}, false
+	}
+	self.order.MoveToFront(element)
+	self.stats.Hits++
+	return element.Value.(*item).entry, true
+}
+
+func (self *LRU) Put(title string, entry Entry) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.capacity <= 0 || self.stale(title, entry) {
+		return
+	}
+	if element, ok := self.items[title]; ok {
+		if element.Value.(*item).entry.Revision > entry.Revision {
+			return
+		}
+		self.order.Remove(element)
+	}
+	self.items[title] = self.order.PushFront(&item{title, entry, self.Now()})
+	for self.order.Len() > self.capacity {
+		oldest := self.order.Back()
+		self.order.Remove(oldest)
+		delete(self.items, oldest.Value.(*item).title)
+		self.stats.Evictions++
+	}
+}
+
+func (self *LRU) remove(title string) {
+	if element, ok := self.items[title]; ok {
+		self.order.Remove(element)
+		delete(self.items, title)
+	}
+}
+
+// Invalidate drops title and refuses later Puts older than revision.
+func (self *LRU) Invalidate(title string, revision int) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.remove(title)
+	self.touch(title, revision)
+}
+
+// Purge drops every page and any render already under way.
+func (self *LRU) Purge() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.order.Init()
+	self.items = map[string]*list.Element{}
+	self.generation++
+	self.horizon = self.generation
+}
+
+func (self *LRU) removeWhere(title string, titles func(Entry) []string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.touch(title, 0)
+	for element := self.order.Front(); element != nil; {
+		next := element.Next()
+		current := element.Value.(*item)
+		for _, candidate := range titles(current.entry) {
+			if candidate == title {
+				self.order.Remove(element)
+				delete(self.items, current.title)
+				break
+			}
+		}
+		element = next
+	}
+}
+
+// InvalidateLinksTo drops every page that links to title.
+func (self *LRU) InvalidateLinksTo(title string) {
+	self.removeWhere(title, func(entry Entry) []string { return entry.Links })
+}
+
+// InvalidateIncludersOf drops every page that transcludes title.
+func (self *LRU) InvalidateIncludersOf(title string) {
+	self.removeWhere(title, func(entry Entry) []string {
+		return entry.Includes
+	})
+}
+
+func (self *LRU) Stats() Stats {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	stats := self.stats
+	stats.Entries = self.order.Len()
+	stats.Capacity = self.capacity
+	return stats
+}
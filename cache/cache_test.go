@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAndPut(t *testing.T) {
+	lru := NewLRU(2)
+	_, ok := lru.Get("A")
+	assert.False(t, ok)
+
+	lru.Put("A", Entry{Revision: 1, Body: []byte("a1")})
+	entry, ok := lru.Get("A")
+	assert.True(t, ok)
+	assert.Equal(t, "a1", string(entry.Body))
+	assert.Equal(t, 1, entry.Revision)
+
+	// An older render never replaces a newer one.
+	lru.Put("A", Entry{Revision: 2, Body: []byte("a2")})
+	lru.Put("A", Entry{Revision: 1, Body: []byte("a1")})
+	entry, _ = lru.Get("A")
+	assert.Equal(t, "a2", string(entry.Body))
+	assert.Equal(t, 2, entry.Revision)
+
+	assert.Equal(t, Stats{Hits: 2, Misses: 1, Entries: 1, Capacity: 2},
+		lru.Stats())
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	lru := NewLRU(2)
+	lru.Put("A", Entry{Revision: 1, Body: []byte("a")})
+	lru.Put("B", Entry{Revision: 1, Body: []byte("b")})
+	lru.Get("A")
+	lru.Put("C", Entry{Revision: 1, Body: []byte("c")})
+
+	_, ok := lru.Get("B")
+	assert.False(t, ok)
+	_, ok = lru.Get("A")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), lru.Stats().Evictions)
+}
+
+func TestInvalidateRejectsStaleRenders(t *testing.T) {
+	lru := NewLRU(2)
+	lru.Put("A", Entry{Revision: 1, Body: []byte("a1")})
+	lru.Invalidate("A", 2)
+	_, ok := lru.Get("A")
+	assert.False(t, ok)
+
+	// A render of revision 1 that finishes after the save is dropped.
+	lru.Put("A", Entry{Revision: 1, Body: []byte("a1")})
+	_, ok = lru.Get("A")
+	assert.False(t, ok)
+	lru.Put("A", Entry{Revision: 2, Body: []byte("a2")})
+	_, ok = lru.Get("A")
+	assert.True(t, ok)
+}
+
+func TestForgetsOldChanges(t *testing.T) {
+	lru := NewLRU(2)
+	generation := lru.Generation()
+	for i := 0; i <= maxChanges; i++ {
+		lru.Invalidate(fmt.Sprintf("P%d", i), 1)
+	}
+	assert.Len(t, lru.changes, maxChanges)
+
+	// Once P0 is forgotten, renders from before it changed are dropped.
+	lru.Put("P0", Entry{Revision: 0, Generation: generation})
+	_, ok := lru.Get("P0")
+	assert.False(t, ok)
+	lru.Put("P0", Entry{Revision: 1, Generation: lru.Generation()})
+	_, ok = lru.Get("P0")
+	assert.True(t, ok)
+}
+
+func TestInvalidateLinksTo(t *testing.T) {
+	lru := NewLRU(3)
+	lru.Put("A", Entry{Revision: 1, Links: []string{"New"}, Body: []byte("a")})
+	lru.Put("B", Entry{Revision: 1, Links: []string{"Other"}, Body: []byte("b")})
+	lru.InvalidateLinksTo("New")
+
+	_, ok := lru.Get("A")
+	assert.False(t, ok)
+	_, ok = lru.Get("B")
+	assert.True(t, ok)
+}
+
+func TestInvalidateIncludersOf(t *testing.T) {
+	lru := NewLRU(3)
+	lru.Put("A", Entry{Revision: 1, Includes: []string{"Snippet"}})
+	lru.Put("B", Entry{Revision: 1, Links: []string{"Snippet"}})
+	lru.InvalidateIncludersOf("Snippet")
+
+	_, ok := lru.Get("A")
+	assert.False(t, ok)
+	_, ok = lru.Get("B")
+	assert.True(t, ok)
+
+	// A render that started before Snippet changed is not cached after.
+	generation := lru.Generation()
+	lru.Invalidate("Snippet", 2)
+	lru.Put("A", Entry{Revision: 1, Generation: generation,
+		Includes: []string{"Snippet"}})
+	_, ok = lru.Get("A")
+	assert.False(t, ok)
+	lru.Put("A", Entry{Revision: 1, Generation: lru.Generation(),
+		Includes: []string{"Snippet"}})
+	_, ok = lru.Get("A")
+	assert.True(t, ok)
+}
+
+func TestPurgeOnStamp(t *testing.T) {
+	lru := NewLRU(2)
+	stamp := NewStamp(t.TempDir())
+	assert.False(t, stamp.Changed())
+
+	generation := lru.Generation()
+	lru.Put("A", Entry{Revision: 1, Generation: generation})
+	assert.NoError(t, stamp.Touch())
+	assert.True(t, stamp.Changed())
+	assert.False(t, stamp.Changed())
+	lru.Purge()
+	_, ok := lru.Get("A")
+	assert.False(t, ok)
+
+	// Renders from before the purge are not cached after it.
+	lru.Put("A", Entry{Revision: 1, Generation: generation})
+	_, ok = lru.Get("A")
+	assert.False(t, ok)
+	lru.Put("A", Entry{Revision: 1, Generation: lru.Generation()})
+	_, ok = lru.Get("A")
+	assert.True(t, ok)
+}
+
+func TestZeroCapacityDisablesCaching(t *testing.T) {
+	lru := NewLRU(0)
+	lru.Put("A", Entry{Revision: 1, Body: []byte("a")})
+	_, ok := lru.Get("A")
+	assert.False(t, ok)
+}
+
+func TestTTLExpiresEntries(t *testing.T) {
+	now := time.Unix(1000, 0)
+	lru := NewLRU(2)
+	lru.TTL = time.Minute
+	lru.Now = func() time.Time { return now }
+	lru.Put("A", Entry{Revision: 1})
+
+	now = now.Add(59 * time.Second)
+	_, ok := lru.Get("A")
+	assert.True(t, ok)
+	now = now.Add(time.Second)
+	_, ok = lru.Get("A")
+	assert.False(t, ok)
+	assert.Equal(t, 0, lru.Stats().Entries)
+	assert.Equal(t, uint64(1), lru.Stats().Misses)
+
+	// A fresh render is cached again for a full TTL.
+	lru.Put("A", Entry{Revision: 1})
+	_, ok = lru.Get("A")
+	assert.True(t, ok)
+}
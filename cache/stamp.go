@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stamp is a file that tools writing pages behind the server's back, like
+// wikictl, touch afterwards. The server checks it before using its cache
+// and purges the cache when it moved.
+type Stamp struct {
+	Path string
+
+	mutex sync.Mutex
+	seen  time.Time
+}
+
+func NewStamp(root string) *Stamp {
+	return &Stamp{Path: filepath.Join(root, ".cache-stamp")}
+}
+
+// Touch marks every cached rendering as out of date.
+func (self *Stamp) Touch() error {
+	now := time.Now()
+	err := os.WriteFile(self.Path,
+		[]byte(strconv.FormatInt(now.UnixNano(), 10)), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(self.Path, now, now)
+}
+
+// Changed says whether the stamp was touched since it was last asked.
+func (self *Stamp) Changed() bool {
+	info, err := os.Stat(self.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	} else if err != nil {
+		// Unreadable: assume the worst rather than serve stale pages.
+		return true
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if info.ModTime().Equal(self.seen) {
+		return false
+	}
+	self.seen = info.ModTime()
+	return true
+}
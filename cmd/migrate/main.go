@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/config"
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+)
+
+func main() {
+	settingsFile := flag.String("settings", "resources/settings.yaml",
+		"settings file naming the destination storage backend")
+	from := flag.String("from", "",
+		"doc root of .txt pages to import (default: the configured doc_root)")
+	flag.Parse()
+
+	config := config.Intantiate(*settingsFile)
+	source := *from
+	if source == "" {
+		source = config.Server.DocRoot
+	}
+	store, err := storage.New(config)
+	if err != nil {
+		log.Fatalf("Failed to open %s storage with %s!!!",
+			config.Storage.Backend, err)
+	}
+	count, err := storage.ImportDocRoot(store, source)
+	if err != nil {
+		log.Fatalf("Import from %s stopped after %d pages with %s!!!",
+			source, count, err)
+	}
+	log.Printf("Imported %d pages from %s.", count, source)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/endpoints"
+	"github.com/mehoggan/simple-wiki-web-app-go/server"
+)
+
+func main() {
+	settingsFile := flag.String("settings", "resources/settings.yaml",
+		"settings file for the doc root, storage and listeners")
+	flag.Parse()
+
+	wiki := endpoints.InitializeEndpoints(*settingsFile)
+	err := server.ListenAndServe(wiki.Config.Server, wiki.Routes())
+	log.Fatalf("Server stopped with %s!!!", err)
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/audit"
+	"github.com/mehoggan/simple-wiki-web-app-go/backup"
+	"github.com/mehoggan/simple-wiki-web-app-go/cache"
+	"github.com/mehoggan/simple-wiki-web-app-go/config"
+	"github.com/mehoggan/simple-wiki-web-app-go/export"
+	"github.com/mehoggan/simple-wiki-web-app-go/importer"
+	"github.com/mehoggan/simple-wiki-web-app-go/render"
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+	"github.com/mehoggan/simple-wiki-web-app-go/templates"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/users"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+	"github.com/mehoggan/simple-wiki-web-app-go/webhooks"
+)
+
+const usage = `usage: wikictl [-settings file] <command> [arguments]
+
+commands:
+  list                           list page titles
+  cat <title>                    print a page's source
+  put [-summary s] [-minor] <title>
+                                 save a page from stdin
+  history <title>                show a page's revisions
+  rename <from> <to>             rename a page
+  delete <title>                 delete a page, keeping its history
+  reindex                        rebuild the tag index and backlinks
+  verify                         check storage and audit log integrity
+  export [-prefix p] [-base url] <dir>
+                                 render pages into a static HTML tree
+  import [-dry-run] mediawiki <dump.xml>
+  import [-dry-run] markdown <dir>
+                                 import pages with their history
+  useradd [-admin] <name>        create a user, reading the password
+                                 from stdin
+  backup [-o file]               write a tar.gz snapshot, to stdout
+                                 without -o
+  backup -scheduled              write a snapshot into backup.dir and
+                                 rotate to backup.retain archives
+  restore [-mode merge|replace] <file>
+                                 validate and restore a snapshot
+
+With the bolt backend the server holds the store open, so stop it before
+running any command.
+`
+
+var titleRegex = regexp.MustCompile("^[a-zA-Z0-9]+$")
+
+type wikictl struct {
+	settings string
+	config   *types.Config
+	store    storage.Storage
+	audit    *audit.Log
+	hooks    *webhooks.Dispatcher
+	stdin    io.Reader
+	stdout   io.Writer
+}
+
+// templates are only parsed for the commands that render, since parsing
+// rewrites them into the doc root.
+func (self *wikictl) templates() *templates.Templates {
+	return templates.InstantiateTemplates(self.settings)
+}
+
+func operator() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return "wikictl"
+}
+
+func checkTitle(title string) error {
+	if !titleRegex.MatchString(title) {
+		return fmt.Errorf("invalid page title %q", title)
+	}
+	return nil
+}
+
+// record audits a mutation and, for page events, queues webhooks for the
+// server's dispatcher to deliver. It also touches the cache stamp, so a
+// running server stops serving what was rendered before.
+func (self *wikictl) record(entry audit.Entry, event *webhooks.Event) error {
+	if err := cache.NewStamp(self.config.Server.DocRoot).Touch(); err != nil {
+		return err
+	}
+	entry.User = operator()
+	entry.IP = "local"
+	if _, err := self.audit.Append(entry); err != nil {
+		return err
+	}
+	if event != nil && len(self.config.Webhooks) > 0 {
+		return self.hooks.Fire(*event)
+	}
+	return nil
+}
+
+func (self *wikictl) list(args []string) error {
+	titles, err := self.store.Titles()
+	if err != nil {
+		return err
+	}
+	for _, title := range titles {
+		fmt.Fprintln(self.stdout, title)
+	}
+	return nil
+}
+
+func (self *wikictl) cat(args []string) error {
+	if len(args) != 1 {
+		return errors.New("cat takes one title")
+	}
+	if err := checkTitle(args[0]); err != nil {
+		return err
+	}
+	page, err := self.store.Load(args[0])
+	if err != nil {
+		return err
+	}
+	source, err := util.Source(page)
+	if err != nil {
+		return err
+	}
+	_, err = self.stdout.Write(source)
+	return err
+}
+
+func (self *wikictl) put(args []string) error {
+	flags := flag.NewFlagSet("put", flag.ContinueOnError)
+	summary := flags.String("summary", "", "edit summary")
+	minor := flags.Bool("minor", false, "mark as a minor edit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("put takes one title")
+	}
+	title := flags.Arg(0)
+	if err := checkTitle(title); err != nil {
+		return err
+	}
+	source, err := io.ReadAll(self.stdin)
+	if err != nil {
+		return err
+	}
+	meta, body, err := util.ParseFrontMatter(source)
+	if err != nil {
+		return fmt.Errorf("invalid front matter: %s", err)
+	}
+	event := webhooks.PageUpdated
+	if _, err = self.store.Load(title); err != nil {
+		event = webhooks.PageCreated
+	}
+	page := &types.Page{Title: title, Body: body, Meta: meta}
+	revision := &types.Revision{Summary: *summary, Minor: *minor,
+		Author: operator(), Timestamp: time.Now().UTC()}
+	if err = self.store.Save(page, revision); err != nil {
+		return err
+	}
+	err = util.UpdateTagIndex(title, util.PageTags(page),
+		self.config.Server.DocRoot)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(self.stdout, "Saved %s r%d.\n", title, revision.Number)
+	return self.record(
+		audit.Entry{Action: audit.Save, Title: title,
+			OldRevision: revision.Number - 1, NewRevision: revision.Number},
+		&webhooks.Event{Type: event, Title: title,
+			Revision: revision.Number, Timestamp: revision.Timestamp})
+}
+
+func (self *wikictl) history(args []string) error {
+	if len(args) != 1 {
+		return errors.New("history takes one title")
+	}
+	if err := checkTitle(args[0]); err != nil {
+		return err
+	}
+	history, err := self.store.History(args[0])
+	if err != nil {
+		return err
+	}
+	for _, revision := range history {
+		minor := ""
+		if revision.Minor {
+			minor = " (minor)"
+		}
+		fmt.Fprintf(self.stdout, "r%d\t%s\t%s\t%s%s\n", revision.Number,
+			revision.Timestamp.Format(time.RFC3339), revision.Author,
+			revision.Summary, minor)
+	}
+	return nil
+}
+
+func (self *wikictl) rename(args []string) error {
+	if len(args) != 2 {
+		return errors.New("rename takes a title and a new title")
+	}
+	from, to := args[0], args[1]
+	for _, title := range args {
+		if err := checkTitle(title); err != nil {
+			return err
+		}
+	}
+	revision := &types.Revision{Author: operator(),
+		Timestamp: time.Now().UTC()}
+	if err := storage.Rename(self.store, from, to, revision); err != nil {
+		return err
+	}
+	docRoot := self.config.Server.DocRoot
+	if err := util.UpdateTagIndex(from, nil, docRoot); err != nil {
+		return err
+	}
+	page, err := self.store.Load(to)
+	if err != nil {
+		return err
+	}
+	if err = util.UpdateTagIndex(to, util.PageTags(page), docRoot); err != nil {
+		return err
+	}
+	fmt.Fprintf(self.stdout, "Renamed %s to %s.\n", from, to)
+	return self.record(
+		audit.Entry{Action: audit.Rename, Title: to, Detail: "from " + from,
+			NewRevision: revision.Number},
+		&webhooks.Event{Type: webhooks.PageRenamed, Title: to, OldTitle: from,
+			Revision: revision.Number, Timestamp: revision.Timestamp})
+}
+
+func (self *wikictl) delete(args []string) error {
+	if len(args) != 1 {
+		return errors.New("delete takes one title")
+	}
+	title := args[0]
+	if err := checkTitle(title); err != nil {
+		return err
+	}
+	history, err := self.store.History(title)
+	if err != nil {
+		return err
+	}
+	revision := &types.Revision{Author: operator(),
+		Timestamp: time.Now().UTC()}
+	if err = self.store.Delete(title, revision); err != nil {
+		return err
+	}
+	err = util.UpdateTagIndex(title, nil, self.config.Server.DocRoot)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(self.stdout, "Deleted %s.\n", title)
+	return self.record(
+		audit.Entry{Action: audit.Delete, Title: title,
+			OldRevision: len(history)},
+		&webhooks.Event{Type: webhooks.PageDeleted, Title: title,
+			Timestamp: revision.Timestamp})
+}
+
+func (self *wikictl) reindex(args []string) error {
+	pages, err := storage.LoadAll(self.store)
+	if err != nil {
+		return err
+	}
+	tags := util.BuildTagIndex(pages)
+	if err = util.SaveTagIndex(tags, self.config.Server.DocRoot); err != nil {
+		return err
+	}
+	if indexed, ok := self.store.(interface{ Reindex() error }); ok {
+		if err = indexed.Reindex(); err != nil {
+			return err
+		}
+	}
+	backlinks := storage.Backlinks(pages)
+	fmt.Fprintf(self.stdout,
+		"Indexed %d pages: %d tags, %d linked titles.\n", len(pages),
+		len(tags), len(backlinks))
+	return nil
+}
+
+func (self *wikictl) verify(args []string) error {
+	problems, err := storage.Verify(self.store)
+	if err != nil {
+		return err
+	}
+	if err = self.audit.Verify(); err != nil {
+		problems = append(problems, err)
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(self.stdout, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+	fmt.Fprintln(self.stdout, "Storage and audit log verified.")
+	return nil
+}
+
+func (self *wikictl) export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	prefix := flags.String("prefix", "", "only export titles with this prefix")
+	base := flags.String("base", "", "base URL for sitemap locations")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("export takes one destination directory")
+	}
+	report, err := export.Export(self.store, self.templates(),
+		export.Directory(flags.Arg(0)), export.Options{Prefix: *prefix,
+			BaseURL: *base, DocRoot: self.config.Server.DocRoot,
+			Render: render.Options{
+				TOCThreshold: self.config.Render.TOCThreshold}})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(self.stdout, "Exported %d pages and %d assets to %s.\n",
+		report.Pages, report.Assets, flags.Arg(0))
+	return nil
+}
+
+func (self *wikictl) importPages(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false,
+		"report conflicts and invalid titles without writing")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("import takes a format and a path")
+	}
+	var documents []importer.Document
+	var err error
+	switch flags.Arg(0) {
+	case "mediawiki":
+		file, err := os.Open(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		documents, err = importer.ReadMediaWiki(file)
+		if err != nil {
+			return err
+		}
+	case "markdown":
+		if documents, err = importer.ReadMarkdown(flags.Arg(1)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown import format %q", flags.Arg(0))
+	}
+
+	// Each page is audited as soon as it is written, so an import that
+	// fails part way still accounts for what it changed.
+	saved := func(planned importer.Planned) error {
+		return self.record(audit.Entry{Action: audit.Import,
+			Title: planned.Title, NewRevision: planned.Revisions,
+			Detail: flags.Arg(0) + ": " + planned.Name}, nil)
+	}
+	report, err := importer.Import(self.store, documents, *dryRun, saved)
+	report.Write(self.stdout, *dryRun)
+	if *dryRun {
+		return err
+	}
+	return errors.Join(err, self.reindex(nil))
+}
+
+func (self *wikictl) useradd(args []string) error {
+	flags := flag.NewFlagSet("useradd", flag.ContinueOnError)
+	admin := flags.Bool("admin", false, "make the user an administrator")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("useradd takes one user name")
+	}
+	name := flags.Arg(0)
+	password, err := bufio.NewReader(self.stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	store := users.NewStore(self.config.Server.DocRoot)
+	if err = store.Create(name, password, *admin); err != nil {
+		return err
+	}
+	fmt.Fprintf(self.stdout, "Created user %s.\n", name)
+	return self.record(audit.Entry{Action: audit.UserCreate, Detail: name},
+		nil)
+}
+
+func (self *wikictl) snapshot(writer io.Writer) error {
+	_, err := backup.Write(self.store, self.config.Server.DocRoot,
+		backup.Options{Backend: self.config.Storage.Backend,
+			ConfigPath: self.settings, Users: true}, writer)
+	return err
+}
+
+func (self *wikictl) backup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "-", "archive to write, - for stdout")
+	scheduled := flags.Bool("scheduled", false,
+		"write into backup.dir and rotate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("backup takes no arguments")
+	}
+	if *scheduled {
+		if self.config.Backup.Dir == "" {
+			return errors.New("backup.dir is not configured")
+		}
+		scheduler := backup.Scheduler{Dir: self.config.Backup.Dir,
+			Retain: self.config.Backup.Retain, Snapshot: self.snapshot,
+			Now: time.Now}
+		path, err := scheduler.RunOnce()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(self.stdout, "Wrote %s.\n", path)
+		return nil
+	}
+	if *output == "-" {
+		return self.snapshot(self.stdout)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = self.snapshot(file); err != nil {
+		file.Close()
+		os.Remove(*output)
+		return err
+	}
+	return file.Close()
+}
+
+func (self *wikictl) restore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	mode := flags.String("mode", backup.Merge, "merge or replace")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("restore takes one archive")
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	archive, err := backup.Read(file)
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	report, err := backup.Restore(self.store, self.config.Server.DocRoot,
+		archive, *mode, operator())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(self.stdout,
+		"Created %d, reverted %d, deleted %d and skipped %d pages; "+
+			"restored %d files.\n", len(report.Created), len(report.Reverted),
+		len(report.Deleted), len(report.Skipped), report.Files)
+	err = self.record(audit.Entry{Action: audit.Restore,
+		Detail: *mode + ": " + flags.Arg(0)}, nil)
+	if err != nil {
+		return err
+	}
+	return self.reindex(nil)
+}
+
+func main() {
+	settingsFile := flag.String("settings", "resources/settings.yaml",
+		"settings file naming the doc root and storage backend")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config := config.Intantiate(*settingsFile)
+	store, err := storage.New(config)
+	if err != nil {
+		log.Fatalf("Failed to open %s storage with %s!!!",
+			config.Storage.Backend, err)
+	}
+	ctl := &wikictl{
+		settings: *settingsFile,
+		config:   config,
+		store:    store,
+		audit:    audit.NewLog(config.Server.DocRoot),
+		hooks:    webhooks.NewDispatcher(config.Webhooks, config.Server.DocRoot),
+		stdin:    os.Stdin,
+		stdout:   os.Stdout}
+	commands := map[string]func([]string) error{
+		"list":    ctl.list,
+		"cat":     ctl.cat,
+		"put":     ctl.put,
+		"history": ctl.history,
+		"rename":  ctl.rename,
+		"delete":  ctl.delete,
+		"reindex": ctl.reindex,
+		"verify":  ctl.verify,
+		"export":  ctl.export,
+		"import":  ctl.importPages,
+		"useradd": ctl.useradd,
+		"backup":  ctl.backup,
+		"restore": ctl.restore}
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err = command(flag.Args()[1:]); err != nil {
+		log.Fatalf("%s failed with %s!!!", flag.Arg(0), err)
+	}
+}
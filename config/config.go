@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"log/slog"
 	"os"
 	"sync"
 
@@ -14,12 +15,11 @@ func loadConfig(resourcePath string) *types.Config {
 	file, err := os.Open(resourcePath)
 	if err != nil {
 		log.Fatalf("Failed to open %s!!!", resourcePath)
-	} else {
-		log.Printf("Opened %s for reading, loading...", resourcePath)
 	}
+	defer file.Close()
 
 	var config types.Config
-	log.Printf("Decoding settings...")
+	slog.Debug("decoding settings", "path", resourcePath)
 	decoder := yaml.NewDecoder(file)
 	if err = decoder.Decode(&config); err != nil {
 		log.Fatalf("Failed to decode config from %s with %s!!!", resourcePath, err)
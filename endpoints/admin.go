@@ -0,0 +1,93 @@
+package endpoints
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/logging"
+	"github.com/mehoggan/simple-wiki-web-app-go/spam"
+)
+
+// tokenLifetime is how long after serving an admin form it can be posted.
+const tokenLifetime = 12 * time.Hour
+
+type adminKey struct{}
+
+// tokenKey signs the tokens of one administrator, so they are no use to
+// another.
+func (self Endpoints) tokenKey(name string) []byte {
+	return append([]byte("admin "+name+"\x00"), self.FormKey...)
+}
+
+// adminToken is what a form served to the request's administrator has to
+// post back, in the csrf field or the X-CSRF-Token header.
+func (self Endpoints) adminToken(request *http.Request) string {
+	name, _ := request.Context().Value(adminKey{}).(string)
+	return spam.Stamp(self.tokenKey(name), time.Now())
+}
+
+func (self Endpoints) validToken(name string, request *http.Request) bool {
+	token := request.Header.Get("X-CSRF-Token")
+	if token == "" {
+		token = request.PostFormValue("csrf")
+	}
+	issued, err := spam.ParseStamp(self.tokenKey(name), token)
+	return err == nil && time.Since(issued) < tokenLifetime
+}
+
+// Admin only lets requests through that carry the HTTP basic credentials
+// of an administrator in the users store. Browsers send those credentials
+// by themselves, so anything but a GET also needs a token from adminToken.
+func (self Endpoints) Admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(writter http.ResponseWriter, request *http.Request) {
+		name, password, ok := request.BasicAuth()
+		if !ok {
+			writter.Header().Set("WWW-Authenticate",
+				`Basic realm="wiki admin", charset="UTF-8"`)
+			http.Error(writter, "Administrator login required.",
+				http.StatusUnauthorized)
+			return
+		}
+		user, ok := self.Users.Authenticate(name, password)
+		if !ok {
+			writter.Header().Set("WWW-Authenticate",
+				`Basic realm="wiki admin", charset="UTF-8"`)
+			http.Error(writter, "Invalid user name or password.",
+				http.StatusUnauthorized)
+			return
+		}
+		if !user.Admin {
+			http.Error(writter, "Administrators only.", http.StatusForbidden)
+			return
+		}
+		safe := request.Method == http.MethodGet ||
+			request.Method == http.MethodHead
+		if !safe && !self.validToken(user.Name, request) {
+			http.Error(writter, "Missing or expired admin token; reload the "+
+				"page and try again.", http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(request.Context(), adminKey{}, user.Name)
+		logger := logging.FromContext(ctx).With("admin", user.Name)
+		next(writter, request.WithContext(logging.WithLogger(ctx, logger)))
+	}
+}
+
+// TokenHandler hands scripts the token their admin posts need.
+func (self Endpoints) TokenHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	writter.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writter.Header().Set("Cache-Control", "no-store")
+	writter.Write([]byte(self.adminToken(request) + "\n"))
+}
+
+// actor names who made a request for the audit log: the administrator
+// when there is one, otherwise the client address.
+func actor(request *http.Request) string {
+	if name, ok := request.Context().Value(adminKey{}).(string); ok {
+		return name
+	}
+	return remoteHost(request)
+}
@@ -0,0 +1,67 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+var apiPageRegex = regexp.MustCompile("^/api/pages/([a-zA-Z0-9]+)$")
+
+type apiPage struct {
+	Title string                 `json:"title"`
+	Body  string                 `json:"body"`
+	Meta  map[string]interface{} `json:"meta"`
+	Tags  []string               `json:"tags"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(writter http.ResponseWriter, status int, value interface{}) {
+	writter.Header().Set("Content-Type", "application/json")
+	writter.WriteHeader(status)
+	if err := json.NewEncoder(writter).Encode(value); err != nil {
+		slog.Error("failed to encode JSON response", "error", err)
+	}
+}
+
+func (self Endpoints) APIPageHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	match := apiPageRegex.FindStringSubmatch(request.URL.Path)
+	if match == nil {
+		writeJSON(writter, http.StatusNotFound, apiError{"invalid page title"})
+		return
+	}
+	page, err := self.store(request).Load(match[1])
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSON(writter, http.StatusNotFound, apiError{"page not found"})
+		return
+	} else if err != nil {
+		writeJSON(writter, http.StatusInternalServerError,
+			apiError{err.Error()})
+		return
+	}
+	meta := page.Meta
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	writeJSON(writter, http.StatusOK, apiPage{
+		Title: page.Title,
+		Body:  string(page.Body),
+		Meta:  meta,
+		Tags:  util.PageTags(page)})
+}
+
+func (self Endpoints) CacheStatsHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	writeJSON(writter, http.StatusOK, self.Cache.Stats())
+}
@@ -0,0 +1,50 @@
+package endpoints
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/audit"
+)
+
+const auditLogLimit = 500
+
+type auditPage struct {
+	User       string
+	Action     string
+	Title      string
+	Since      string
+	ChainError string
+	Entries    []audit.Entry
+}
+
+func (self Endpoints) AuditHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	query := request.URL.Query()
+	view := &auditPage{
+		User:   query.Get("user"),
+		Action: query.Get("action"),
+		Title:  query.Get("title"),
+		Since:  query.Get("since")}
+	filter := audit.Filter{User: view.User, Action: view.Action,
+		Title: view.Title}
+	if view.Since != "" {
+		since, err := time.Parse("2006-01-02", view.Since)
+		if err != nil {
+			http.Error(writter, "Invalid since date.", http.StatusBadRequest)
+			return
+		}
+		filter.Since = since
+	}
+	entries, err := self.Audit.Load(filter, auditLogLimit)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	view.Entries = entries
+	if err = self.Audit.Verify(); err != nil {
+		view.ChainError = err.Error()
+	}
+	self.Templates.RenderTemplate(writter, "audit", view)
+}
@@ -0,0 +1,140 @@
+package endpoints
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/audit"
+	"github.com/mehoggan/simple-wiki-web-app-go/backup"
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+const maxRestoreSize = 1 << 30
+
+func (self Endpoints) snapshot(
+	writer io.Writer,
+	options backup.Options) error {
+	self.Writes.Lock()
+	defer self.Writes.Unlock()
+	options.Backend = self.Config.Storage.Backend
+	_, err := backup.Write(self.Storage, self.Config.Server.DocRoot, options,
+		writer)
+	return err
+}
+
+func (self Endpoints) backupScheduler() (*backup.Scheduler, error) {
+	interval, err := time.ParseDuration(self.Config.Backup.Interval)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("backup interval %s is not positive", interval)
+	}
+	return &backup.Scheduler{
+		Dir:      self.Config.Backup.Dir,
+		Interval: interval,
+		Retain:   self.Config.Backup.Retain,
+		Snapshot: self.fullSnapshot,
+		Now:      time.Now}, nil
+}
+
+// fullSnapshot is what scheduled backups keep on the host: everything,
+// config and users included.
+func (self Endpoints) fullSnapshot(writer io.Writer) error {
+	return self.snapshot(writer, backup.Options{ConfigPath: self.ConfigPath,
+		Users: true})
+}
+
+// BackupHandler serves a tar.gz of the wiki's pages and sidecar files. The
+// config and password hashes stay on the host; use wikictl backup for
+// those. Saves wait while the archive is built in memory, not while it is
+// sent.
+func (self Endpoints) BackupHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	var buffer bytes.Buffer
+	if err := self.snapshot(&buffer, backup.Options{}); err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := "wiki-" + time.Now().UTC().Format("20060102T150405Z") + ".tar.gz"
+	writter.Header().Set("Content-Type", "application/gzip")
+	writter.Header().Set("Content-Disposition",
+		`attachment; filename="`+name+`"`)
+	writter.Header().Set("Content-Length", strconv.Itoa(buffer.Len()))
+	writter.Write(buffer.Bytes())
+}
+
+// rebuildTagIndex indexes the tags of every page from storage, as wikictl
+// reindex does, so it also works when pages are not under the doc root.
+func (self Endpoints) rebuildTagIndex() error {
+	pages, err := storage.LoadAll(self.Storage)
+	if err != nil {
+		return err
+	}
+	return util.SaveTagIndex(util.BuildTagIndex(pages),
+		self.Config.Server.DocRoot)
+}
+
+// RestoreHandler takes a backup as the POST body and restores it with the
+// mode query parameter, merge by default. Users and the audit log are never
+// restored over HTTP, so an archive cannot plant an account or rewrite
+// history.
+func (self Endpoints) RestoreHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	if request.Method != http.MethodPost {
+		writter.Header().Set("Allow", http.MethodPost)
+		http.Error(writter, "Restore requires a POST.",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	mode := request.URL.Query().Get("mode")
+	if mode == "" {
+		mode = backup.Merge
+	}
+	archive, err := backup.Read(http.MaxBytesReader(writter, request.Body,
+		maxRestoreSize))
+	if err != nil {
+		http.Error(writter, "Invalid backup: "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+	delete(archive.Files, backup.UsersFile)
+
+	self.Writes.Lock()
+	report, err := backup.Restore(self.store(request),
+		self.Config.Server.DocRoot, archive, mode, actor(request))
+	if err == nil {
+		err = self.rebuildTagIndex()
+	}
+	self.Writes.Unlock()
+	for _, page := range archive.Pages {
+		self.Cache.Invalidate(page.Title, 0)
+		self.Cache.InvalidateIncludersOf(page.Title)
+	}
+	for _, title := range report.Deleted {
+		self.Cache.Invalidate(title, 0)
+		self.Cache.InvalidateIncludersOf(title)
+	}
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err = self.Audit.Append(audit.Entry{
+		User:   actor(request),
+		IP:     remoteHost(request),
+		Action: audit.Restore,
+		Detail: fmt.Sprintf("%s: %d created, %d reverted, %d deleted", mode,
+			len(report.Created), len(report.Reverted),
+			len(report.Deleted))}); err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(writter, http.StatusOK, report)
+}
@@ -0,0 +1,51 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/export"
+	"github.com/mehoggan/simple-wiki-web-app-go/logging"
+)
+
+// countingWriter tells whether anything reached the client yet.
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (self *countingWriter) Write(data []byte) (int, error) {
+	n, err := self.ResponseWriter.Write(data)
+	self.written += int64(n)
+	return n, err
+}
+
+// ExportHandler streams the static export as a zip. A failure before the
+// first byte is still a 500; after it the connection is cut, so the client
+// sees a broken download rather than a zip that looks whole.
+func (self Endpoints) ExportHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	options := export.Options{
+		Prefix:  request.URL.Query().Get("prefix"),
+		BaseURL: request.URL.Query().Get("base"),
+		DocRoot: self.Config.Server.DocRoot,
+		Render:  self.renderOptions(request)}
+	writter.Header().Set("Content-Type", "application/zip")
+	writter.Header().Set("Content-Disposition",
+		`attachment; filename="wiki-export.zip"`)
+	counted := &countingWriter{ResponseWriter: writter}
+	_, err := export.ExportZip(self.store(request), self.Templates, counted,
+		options)
+	if err == nil {
+		return
+	}
+	if counted.written == 0 {
+		writter.Header().Del("Content-Disposition")
+		writter.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(request.Context()).Error("export failed midway",
+		"written", counted.written, "error", err)
+	panic(http.ErrAbortHandler)
+}
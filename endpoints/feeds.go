@@ -0,0 +1,121 @@
+package endpoints
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/feeds"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+const feedEntriesLimit = 50
+
+var feedRegex = regexp.MustCompile(
+	"^/feeds/(recent\\.(atom|rss)|page/([a-zA-Z0-9]+)\\.atom)$")
+
+func baseURL(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host
+}
+
+// addDiffs fills in what each entry's revision changed.
+func (self Endpoints) addDiffs(
+	request *http.Request,
+	entries []feeds.Entry) error {
+	for i := range entries {
+		revision := entries[i].Revision
+		before := ""
+		if revision.Number > 1 {
+			previous, err := self.store(request).Revision(revision.Title,
+				revision.Number-1)
+			if err != nil {
+				return err
+			}
+			source, err := util.Source(previous)
+			if err != nil {
+				return err
+			}
+			before = string(source)
+		}
+		current, err := self.store(request).Revision(revision.Title,
+			revision.Number)
+		if err != nil {
+			return err
+		}
+		after, err := util.Source(current)
+		if err != nil {
+			return err
+		}
+		entries[i].Diff = util.Diff(before, string(after))
+	}
+	return nil
+}
+
+func (self Endpoints) FeedHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	match := feedRegex.FindStringSubmatch(request.URL.Path)
+	if match == nil {
+		http.NotFound(writter, request)
+		return
+	}
+
+	title := match[3]
+	var revisions []types.Revision
+	var err error
+	if title == "" {
+		revisions, err = self.store(request).RecentChanges(feedEntriesLimit, false)
+	} else {
+		revisions, err = self.store(request).History(title)
+		for i, j := 0, len(revisions)-1; i < j; i, j = i+1, j-1 {
+			revisions[i], revisions[j] = revisions[j], revisions[i]
+		}
+		if len(revisions) > feedEntriesLimit {
+			revisions = revisions[:feedEntriesLimit]
+		}
+	}
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The revisions alone identify the feed, so a client that has it
+	// costs no diffs.
+	entries := []feeds.Entry{}
+	for _, revision := range revisions {
+		entries = append(entries, feeds.Entry{Revision: revision})
+	}
+	writter.Header().Set("Cache-Control", self.cacheControl())
+	if notModified(writter, request, feeds.ETag(entries),
+		feeds.Updated(entries)) {
+		return
+	}
+	if err = self.addDiffs(request, entries); err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	base := baseURL(request)
+	var body []byte
+	if match[2] == "rss" {
+		writter.Header().Set("Content-Type", "application/rss+xml")
+		body, err = feeds.RSS("Recent changes", base,
+			"Recent changes to the wiki", entries)
+	} else if title == "" {
+		writter.Header().Set("Content-Type", "application/atom+xml")
+		body, err = feeds.Atom("Recent changes", "urn:wiki:feed:recent",
+			base, base+request.URL.Path, entries)
+	} else {
+		writter.Header().Set("Content-Type", "application/atom+xml")
+		body, err = feeds.Atom("History of "+title, "urn:wiki:feed:page:"+title,
+			base, base+request.URL.Path, entries)
+	}
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writter.Write(body)
+}
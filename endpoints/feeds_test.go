@@ -0,0 +1,74 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageFeed(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, "Feed.txt"))
+	util.SaveRevision(&types.Page{Title: "Feed", Body: []byte("one\n")},
+		&types.Revision{Summary: "Create", Timestamp: time.Now()}, *rootPath)
+	util.SaveRevision(&types.Page{Title: "Feed", Body: []byte("two\n")},
+		&types.Revision{Summary: "Change", Timestamp: time.Now()}, *rootPath)
+
+	req := httptest.NewRequest(http.MethodGet, "/feeds/page/Feed.atom", nil)
+	rec := httptest.NewRecorder()
+	endpoints.FeedHandler(rec, req)
+	res := rec.Result()
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "application/atom+xml", res.Header.Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "urn:wiki:revision:Feed:2")
+	assert.Contains(t, rec.Body.String(), "-one&#xA;+two")
+	etag := res.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	req = httptest.NewRequest(http.MethodGet, "/feeds/page/Feed.atom", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	endpoints.FeedHandler(rec, req)
+	assert.Equal(t, 304, rec.Result().StatusCode)
+	assert.Empty(t, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/feeds/page/Feed.atom", nil)
+	req.Header.Set("If-Modified-Since", res.Header.Get("Last-Modified"))
+	rec = httptest.NewRecorder()
+	endpoints.FeedHandler(rec, req)
+	assert.Equal(t, 304, rec.Result().StatusCode)
+}
+
+func TestRecentFeeds(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, "Recent.txt"))
+	util.SaveRevision(&types.Page{Title: "Recent", Body: []byte("one\n")},
+		&types.Revision{Summary: "Create", Timestamp: time.Now()}, *rootPath)
+
+	req := httptest.NewRequest(http.MethodGet, "/feeds/recent.rss", nil)
+	rec := httptest.NewRecorder()
+	endpoints.FeedHandler(rec, req)
+	assert.Equal(t, 200, rec.Result().StatusCode)
+	assert.Contains(t, rec.Body.String(), "<rss version=\"2.0\">")
+	assert.Contains(t, rec.Body.String(), "http://example.com/view/Recent")
+
+	req = httptest.NewRequest(http.MethodGet, "/feeds/recent.atom", nil)
+	rec = httptest.NewRecorder()
+	endpoints.FeedHandler(rec, req)
+	assert.Equal(t, 200, rec.Result().StatusCode)
+	assert.Contains(t, rec.Body.String(), "urn:wiki:revision:Recent:1")
+
+	req = httptest.NewRequest(http.MethodGet, "/feeds/recent.json", nil)
+	rec = httptest.NewRecorder()
+	endpoints.FeedHandler(rec, req)
+	assert.Equal(t, 404, rec.Result().StatusCode)
+}
@@ -0,0 +1,98 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+type buildInfo struct {
+	Path      string `json:"path"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// HealthzHandler only shows that the process is serving requests.
+func (self Endpoints) HealthzHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	writeJSON(writter, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (self Endpoints) readinessChecks() map[string]error {
+	checks := map[string]error{}
+	if self.Config == nil || self.Config.Server.DocRoot == "" {
+		checks["config"] = errors.New("doc_root is not configured")
+	} else {
+		checks["config"] = nil
+		checks["doc_root"] = util.Writable(self.Config.Server.DocRoot)
+	}
+	if self.Templates == nil {
+		checks["templates"] = errors.New("templates have not been loaded")
+	} else {
+		checks["templates"] = self.Templates.Check()
+	}
+	if self.Storage == nil {
+		checks["storage"] = errors.New("storage has not been opened")
+	} else {
+		_, err := self.Storage.Titles()
+		checks["storage"] = err
+	}
+	return checks
+}
+
+// ReadyzHandler fails with 503 until the config is loaded, the templates are
+// parsed, storage answers and doc_root takes writes.
+func (self Endpoints) ReadyzHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	status := http.StatusOK
+	result := readiness{Status: "ok", Checks: map[string]string{}}
+	for name, err := range self.readinessChecks() {
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			result.Status = "unavailable"
+			result.Checks[name] = err.Error()
+		} else {
+			result.Checks[name] = "ok"
+		}
+	}
+	writeJSON(writter, status, result)
+}
+
+func (self Endpoints) VersionHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		writeJSON(writter, http.StatusInternalServerError,
+			apiError{Error: "build info is not available"})
+		return
+	}
+	result := buildInfo{
+		Path:      info.Main.Path,
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			result.Revision = setting.Value
+		case "vcs.time":
+			result.Time = setting.Value
+		case "vcs.modified":
+			result.Modified = strings.EqualFold(setting.Value, "true")
+		}
+	}
+	writeJSON(writter, http.StatusOK, result)
+}
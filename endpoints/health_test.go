@@ -0,0 +1,52 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+func TestHealthAndVersion(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	routes := endpoints.Routes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	info := buildInfo{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.NotEmpty(t, info.GoVersion)
+}
+
+func TestReadyzHandler(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	rec := httptest.NewRecorder()
+	endpoints.ReadyzHandler(rec,
+		httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"doc_root":"ok"`)
+
+	// A doc_root that has gone away makes the instance unready.
+	missing := *endpoints
+	missing.Config = &types.Config{Server: types.Server{
+		DocRoot: path.Join(t.TempDir(), "missing")}}
+	rec = httptest.NewRecorder()
+	missing.ReadyzHandler(rec,
+		httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	result := readiness{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, "unavailable", result.Status)
+	assert.Contains(t, result.Checks["doc_root"], "no such file")
+	assert.Equal(t, "ok", result.Checks["templates"])
+}
@@ -0,0 +1,183 @@
+package endpoints
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+const defaultCacheControl = "no-cache"
+
+var encodingSuffixes = []string{"-br\"", "-gzip\""}
+
+func (self Endpoints) cacheControl() string {
+	if self.Config.Cache.CacheControl == "" {
+		return defaultCacheControl
+	}
+	return self.Config.Cache.CacheControl
+}
+
+// sameETag compares entity tags the way If-None-Match requires: weakly, and
+// ignoring the suffix Compress adds to compressed representations.
+func sameETag(candidate string, etag string) bool {
+	candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+	for _, suffix := range encodingSuffixes {
+		if strings.HasSuffix(candidate, suffix) {
+			candidate = strings.TrimSuffix(candidate, suffix) + "\""
+		}
+	}
+	return candidate == etag || candidate == "*"
+}
+
+func notModified(
+	writter http.ResponseWriter,
+	request *http.Request,
+	etag string,
+	modified time.Time) bool {
+	writter.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		writter.Header().Set("Last-Modified",
+			modified.UTC().Format(http.TimeFormat))
+	}
+
+	if match := request.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			if sameETag(candidate, etag) {
+				writter.WriteHeader(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+	if since := request.Header.Get("If-Modified-Since"); since != "" &&
+		!modified.IsZero() {
+		sinceTime, err := http.ParseTime(since)
+		if err == nil && !modified.Truncate(time.Second).After(sinceTime) {
+			writter.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func acceptedEncoding(request *http.Request) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(request.Header.Get("Accept-Encoding"),
+		",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		quality := 1.0
+		for _, parameter := range fields[1:] {
+			parameter = strings.TrimSpace(parameter)
+			if strings.HasPrefix(parameter, "q=") {
+				quality, _ = strconv.ParseFloat(parameter[2:], 64)
+			}
+		}
+		accepted[name] = quality > 0
+	}
+	for _, encoding := range []string{"br", "gzip"} {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// precompressed are content types that are compressed already, so encoding
+// them again only costs CPU.
+var precompressed = map[string]bool{
+	"application/zip":    true,
+	"application/gzip":   true,
+	"application/x-gzip": true}
+
+// compressWriter holds back the status line until the first write so it
+// can sniff the content type from uncompressed bytes and skip compression
+// for bodiless and already compressed responses.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	encoder     io.WriteCloser
+	status      int
+	wroteHeader bool
+}
+
+func (self *compressWriter) WriteHeader(status int) {
+	if self.status == 0 {
+		self.status = status
+	}
+}
+
+func (self *compressWriter) start() {
+	self.wroteHeader = true
+	if self.status == 0 {
+		self.status = http.StatusOK
+	}
+	header := self.Header()
+	contentType, _, _ := strings.Cut(header.Get("Content-Type"), ";")
+	if self.status == http.StatusNoContent ||
+		self.status == http.StatusNotModified ||
+		header.Get("Content-Encoding") != "" ||
+		precompressed[strings.TrimSpace(contentType)] {
+		self.ResponseWriter.WriteHeader(self.status)
+		return
+	}
+
+	header.Set("Content-Encoding", self.encoding)
+	header.Del("Content-Length")
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, "\"") {
+		header.Set("ETag",
+			strings.TrimSuffix(etag, "\"")+"-"+self.encoding+"\"")
+	}
+	if self.encoding == "br" {
+		self.encoder = brotli.NewWriter(self.ResponseWriter)
+	} else {
+		self.encoder = gzip.NewWriter(self.ResponseWriter)
+	}
+	self.ResponseWriter.WriteHeader(self.status)
+}
+
+func (self *compressWriter) Write(data []byte) (int, error) {
+	if !self.wroteHeader {
+		if self.Header().Get("Content-Type") == "" {
+			self.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		self.start()
+	}
+	if self.encoder == nil {
+		return self.ResponseWriter.Write(data)
+	}
+	return self.encoder.Write(data)
+}
+
+func (self *compressWriter) Close() error {
+	if !self.wroteHeader {
+		self.start()
+	}
+	if self.encoder == nil {
+		return nil
+	}
+	return self.encoder.Close()
+}
+
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(
+		writter http.ResponseWriter,
+		request *http.Request) {
+		writter.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(request)
+		if encoding == "" || request.Method == http.MethodHead {
+			next.ServeHTTP(writter, request)
+			return
+		}
+		compressed := &compressWriter{
+			ResponseWriter: writter,
+			encoding:       encoding}
+		defer compressed.Close()
+		next.ServeHTTP(compressed, request)
+	})
+}
@@ -0,0 +1,116 @@
+package endpoints
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                     "",
+		"gzip":                 "gzip",
+		"gzip, deflate, br":    "br",
+		"br;q=0, gzip;q=0.5":   "gzip",
+		"identity":             "",
+		"GZIP;q=1.0, br;q=0.0": "gzip"}
+	for header, expected := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", header)
+		assert.Equalf(t, expected, acceptedEncoding(req),
+			"Wrong encoding for %q.", header)
+	}
+}
+
+func TestViewConditionalGetAndCompression(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Conditional.txt"))
+	savePageForm(endpoints, "Conditional", "Cache me.")
+	routes := endpoints.Routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/view/Conditional", nil)
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	res := rec.Result()
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+	assert.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+	assert.Empty(t, res.Header.Get("Content-Encoding"))
+	etag := res.Header.Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, "\"Conditional-r1-"))
+	assert.NotEmpty(t, res.Header.Get("Last-Modified"))
+
+	req = httptest.NewRequest(http.MethodGet, "/view/Conditional", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	res = rec.Result()
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, strings.TrimSuffix(etag, "\"")+"-gzip\"",
+		res.Header.Get("ETag"))
+	assert.Contains(t, res.Header.Get("Content-Type"), "text/html")
+	reader, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatalf("Response was not gzip encoded: %s.", err)
+	}
+	body, _ := ioutil.ReadAll(reader)
+	assert.Contains(t, string(body), "Cache me.")
+
+	// The compressed ETag validates too.
+	req = httptest.NewRequest(http.MethodGet, "/view/Conditional", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", res.Header.Get("ETag"))
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Equal(t, 304, rec.Result().StatusCode)
+	assert.Empty(t, rec.Body.Bytes())
+	assert.Empty(t, rec.Result().Header.Get("Content-Encoding"))
+
+	req = httptest.NewRequest(http.MethodGet, "/view/Conditional", nil)
+	req.Header.Set("If-Modified-Since", res.Header.Get("Last-Modified"))
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Equal(t, 304, rec.Result().StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/view/Conditional", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Equal(t, "br", rec.Result().Header.Get("Content-Encoding"))
+	body, _ = ioutil.ReadAll(brotli.NewReader(rec.Result().Body))
+	assert.Contains(t, string(body), "Cache me.")
+
+	// A new revision changes the ETag.
+	savePageForm(endpoints, "Conditional", "Changed.")
+	req = httptest.NewRequest(http.MethodGet, "/view/Conditional", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Equal(t, 200, rec.Result().StatusCode)
+	assert.True(t, strings.HasPrefix(rec.Result().Header.Get("ETag"),
+		"\"Conditional-r2-"))
+}
+
+func TestCompressSkipsArchives(t *testing.T) {
+	handler := Compress(http.HandlerFunc(
+		func(writter http.ResponseWriter, request *http.Request) {
+			writter.Header().Set("Content-Type", "application/zip")
+			writter.Write([]byte("PK\x03\x04"))
+		}))
+	req := httptest.NewRequest(http.MethodGet, "/admin/export", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Empty(t, rec.Result().Header.Get("Content-Encoding"))
+	assert.Equal(t, "PK\x03\x04", rec.Body.String())
+}
@@ -0,0 +1,101 @@
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/ratelimit"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+const defaultMaxBodyBytes = 1 << 20
+
+// defaultRates apply to endpoints the config does not name. Upload, search
+// and login get limits as soon as they are routed through Limit.
+var defaultRates = map[string]types.RateLimit{
+	"save":    {PerMinute: 10, Burst: 5},
+	"revert":  {PerMinute: 10, Burst: 5},
+	"preview": {PerMinute: 30, Burst: 10},
+	"upload":  {PerMinute: 10, Burst: 5},
+	"search":  {PerMinute: 60, Burst: 20},
+	"feeds":   {PerMinute: 30, Burst: 10},
+	"login":   {PerMinute: 5, Burst: 5},
+	"export":  {PerMinute: 6, Burst: 3},
+	"backup":  {PerMinute: 2, Burst: 2},
+	"restore": {PerMinute: 2, Burst: 2}}
+
+// newLimiters refuses a rate that never refills, which would lock a client
+// out for good after its burst.
+func newLimiters(config *types.Config) (map[string]*ratelimit.Limiter,
+	error) {
+	limiters := map[string]*ratelimit.Limiter{}
+	for name, rate := range defaultRates {
+		limiters[name] = ratelimit.New(rate.PerMinute, rate.Burst)
+	}
+	for name, rate := range config.Limits.Rates {
+		if rate.PerMinute <= 0 {
+			return nil, fmt.Errorf("rate limit %s: per_minute must be "+
+				"positive, not %v", name, rate.PerMinute)
+		}
+		limiters[name] = ratelimit.New(rate.PerMinute, rate.Burst)
+	}
+	return limiters, nil
+}
+
+func (self Endpoints) maxBodyBytes() int64 {
+	if self.Config.Limits.MaxBodyBytes == 0 {
+		return defaultMaxBodyBytes
+	}
+	return self.Config.Limits.MaxBodyBytes
+}
+
+// Throttle rate limits the client on the endpoint called name. Clients are
+// told how long to wait with Retry-After.
+func (self Endpoints) Throttle(
+	name string,
+	next http.HandlerFunc) http.HandlerFunc {
+	return func(writter http.ResponseWriter, request *http.Request) {
+		if limiter, ok := self.Limiters[name]; ok {
+			allowed, wait := limiter.Allow(remoteHost(request))
+			if !allowed {
+				seconds := int(math.Ceil(wait.Seconds()))
+				writter.Header().Set("Retry-After", strconv.Itoa(seconds))
+				http.Error(writter, "Too many requests, try again later.",
+					http.StatusTooManyRequests)
+				return
+			}
+		}
+		next(writter, request)
+	}
+}
+
+// Limit caps the request body as well as throttling. Endpoints that take
+// larger bodies, like restore, cap their own and only use Throttle.
+func (self Endpoints) Limit(name string, next http.HandlerFunc) http.HandlerFunc {
+	return self.Throttle(name,
+		func(writter http.ResponseWriter, request *http.Request) {
+			request.Body = http.MaxBytesReader(writter, request.Body,
+				self.maxBodyBytes())
+			next(writter, request)
+		})
+}
+
+// parseForm reads the request's form, answering 413 when the body was cut
+// off by Limit and 400 when it is otherwise malformed.
+func parseForm(writter http.ResponseWriter, request *http.Request) bool {
+	err := request.ParseForm()
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(writter, fmt.Sprintf("Request body exceeds %d bytes.",
+			tooLarge.Limit), http.StatusRequestEntityTooLarge)
+	} else {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package endpoints
+
+import "sync"
+
+// TitleLocks serialises writes to each title, so a save's conflict check
+// and the write it allows happen as one step. Locks are dropped once
+// nobody holds or waits for them.
+type TitleLocks struct {
+	mutex sync.Mutex
+	locks map[string]*titleLock
+}
+
+type titleLock struct {
+	sync.Mutex
+	waiting int
+}
+
+func NewTitleLocks() *TitleLocks {
+	return &TitleLocks{locks: map[string]*titleLock{}}
+}
+
+// Lock blocks until title is free and returns the function releasing it.
+func (self *TitleLocks) Lock(title string) func() {
+	self.mutex.Lock()
+	lock, ok := self.locks[title]
+	if !ok {
+		lock = &titleLock{}
+		self.locks[title] = lock
+	}
+	lock.waiting++
+	self.mutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		self.mutex.Lock()
+		lock.waiting--
+		if lock.waiting == 0 {
+			delete(self.locks, title)
+		}
+		self.mutex.Unlock()
+	}
+}
@@ -0,0 +1,162 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/audit"
+	"github.com/mehoggan/simple-wiki-web-app-go/spam"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+var moderationRegex = regexp.MustCompile(
+	"^/admin/moderation(?:/(approve|discard))?$")
+
+// submission is what the spam filters see of a save. Started is only
+// trusted when its stamp was signed by this wiki.
+func (self Endpoints) submission(
+	request *http.Request,
+	title string,
+	source []byte,
+	received time.Time) spam.Submission {
+	held := spam.Submission{
+		Title:    title,
+		Source:   source,
+		Honeypot: request.FormValue("website"),
+		Received: received,
+		IP:       remoteHost(request)}
+	started, err := spam.ParseStamp(self.FormKey, request.FormValue("started"))
+	if err == nil {
+		held.Started = started
+	}
+	return held
+}
+
+// hold queues an edit the spam filters rejected, for reason. source is the
+// whole page as the edit would save it on top of revision base.
+func (self Endpoints) hold(
+	writter http.ResponseWriter,
+	request *http.Request,
+	title string,
+	source []byte,
+	base int,
+	revision *types.Revision,
+	reason error) {
+	held, err := self.Moderation.Hold(spam.Held{
+		Title:    title,
+		Source:   string(source),
+		Summary:  revision.Summary,
+		Minor:    revision.Minor,
+		Author:   revision.Author,
+		IP:       remoteHost(request),
+		Reason:   reason.Error(),
+		Revision: base,
+		Received: revision.Timestamp})
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = self.Audit.Append(audit.Entry{
+		User:   revision.Author,
+		IP:     remoteHost(request),
+		Action: audit.Hold,
+		Title:  title,
+		Detail: held.ID + ": " + held.Reason})
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writter.WriteHeader(http.StatusAccepted)
+	writter.Write([]byte("<h1>Your edit is waiting for moderation.</h1>"))
+}
+
+// ModerationHandler lists held edits and approves or discards them. An
+// approval conflicts, like a save, when the page changed after the edit was
+// held.
+func (self Endpoints) ModerationHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	match := moderationRegex.FindStringSubmatch(request.URL.Path)
+	if match == nil {
+		http.NotFound(writter, request)
+		return
+	}
+	if match[1] == "" {
+		held, err := self.Moderation.List()
+		if err != nil {
+			http.Error(writter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writter.Header().Set("Cache-Control", "no-store")
+		self.Templates.RenderTemplate(writter, "moderation", struct {
+			Held  []spam.Held
+			Token string
+		}{held, self.adminToken(request)})
+		return
+	}
+	if request.Method != http.MethodPost {
+		writter.Header().Set("Allow", http.MethodPost)
+		http.Error(writter, "Moderation requires a POST.",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	held, err := self.Moderation.Get(request.FormValue("id"))
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(writter, request)
+		return
+	} else if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	action := audit.Discard
+	if match[1] == "approve" {
+		action = audit.Approve
+		defer self.Locks.Lock(held.Title)()
+		history, err := self.store(request).History(held.Title)
+		if err != nil {
+			http.Error(writter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(history) != held.Revision {
+			editConflict(writter, held.Title, "", held.Source)
+			return
+		}
+		meta, body, err := util.ParseFrontMatter([]byte(held.Source))
+		if err != nil {
+			http.Error(writter, "Invalid front matter: "+err.Error(),
+				http.StatusBadRequest)
+			return
+		}
+		revision := &types.Revision{
+			Summary:   held.Summary,
+			Minor:     held.Minor,
+			Author:    held.Author,
+			Timestamp: time.Now().UTC()}
+		err = self.savePage(request, audit.Save,
+			&types.Page{Title: held.Title, Body: body, Meta: meta}, revision)
+		if err != nil {
+			http.Error(writter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err = self.Moderation.Remove(held.ID); err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = self.Audit.Append(audit.Entry{
+		User:   actor(request),
+		IP:     remoteHost(request),
+		Action: action,
+		Title:  held.Title,
+		Detail: held.ID})
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(writter, request, "/admin/moderation", http.StatusFound)
+}
@@ -0,0 +1,64 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/logging"
+)
+
+// crossOrigin refuses unsafe requests a browser sent from another site, so
+// no other page a visitor has open can save, revert or administer for them.
+// Clients other than browsers send no such headers and are let through.
+var crossOrigin = http.NewCrossOriginProtection()
+
+func (self Endpoints) Routes() http.Handler {
+	instrument := self.Metrics.Instrument
+	mux := http.NewServeMux()
+	mux.HandleFunc("/view/",
+		instrument("view", self.MakeHandler(self.ViewHandler)))
+	mux.HandleFunc("/edit/",
+		instrument("edit", self.MakeHandler(self.EditHandler)))
+	mux.HandleFunc("/save/",
+		instrument("save",
+			self.Limit("save", self.MakeHandler(self.SaveHandler))))
+	mux.HandleFunc("/preview/",
+		instrument("preview",
+			self.Limit("preview", self.MakeHandler(self.PreviewHandler))))
+	mux.HandleFunc("/history/",
+		instrument("history", self.MakeHandler(self.HistoryHandler)))
+	mux.HandleFunc("/revert/",
+		instrument("revert",
+			self.Limit("revert", self.MakeHandler(self.RevertHandler))))
+	mux.HandleFunc("/recent", instrument("recent", self.RecentHandler))
+	mux.HandleFunc("/feeds/", instrument("feeds",
+		self.Throttle("feeds", self.FeedHandler)))
+	mux.HandleFunc("/tags", instrument("tags", self.TagsHandler))
+	mux.HandleFunc("/tags/", instrument("tags", self.TagsHandler))
+	// Receiver URLs often carry tokens, so only admins see deliveries.
+	mux.HandleFunc("/webhooks/deliveries",
+		instrument("webhooks", self.Admin(self.DeliveriesHandler)))
+	mux.HandleFunc("/api/pages/", instrument("api", self.APIPageHandler))
+	mux.HandleFunc("/api/cache", instrument("api", self.CacheStatsHandler))
+	mux.Handle("/metrics", self.Metrics.Handler())
+	mux.HandleFunc("/admin/audit",
+		instrument("admin", self.Admin(self.AuditHandler)))
+	mux.HandleFunc("/admin/export", instrument("admin",
+		self.Throttle("export", self.Admin(self.ExportHandler))))
+	mux.HandleFunc("/admin/backup", instrument("admin",
+		self.Throttle("backup", self.Admin(self.BackupHandler))))
+	mux.HandleFunc("/admin/restore", instrument("admin",
+		self.Throttle("restore", self.Admin(self.RestoreHandler))))
+	mux.HandleFunc("/admin/moderation",
+		instrument("admin", self.Admin(self.ModerationHandler)))
+	mux.HandleFunc("/admin/moderation/",
+		instrument("admin", self.Admin(self.ModerationHandler)))
+	mux.HandleFunc("/admin/token",
+		instrument("admin", self.Admin(self.TokenHandler)))
+	// Anything else under /admin/ still needs a login before it 404s.
+	mux.HandleFunc("/admin/", self.Admin(http.NotFound))
+	mux.HandleFunc("/healthz", self.HealthzHandler)
+	mux.HandleFunc("/readyz", self.ReadyzHandler)
+	mux.HandleFunc("/version", self.VersionHandler)
+	return logging.RequestID(self.Logger,
+		logging.AccessLog(Compress(crossOrigin.Handler(mux))))
+}
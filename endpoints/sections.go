@@ -0,0 +1,106 @@
+package endpoints
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/render"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+var errEditConflict = errors.New("page changed since the edit started")
+
+// editedSource is the whole page source a save stores and the revision it
+// is built on. A section edit is spliced into the current source. When the
+// form says which revision it was served from, a whole-page save conflicts
+// with any save since, and a section save only with saves that changed
+// that section. Callers hold the title's lock until the result is saved.
+func (self Endpoints) editedSource(
+	request *http.Request,
+	title string) ([]byte, int, error) {
+	edited := []byte(request.FormValue("body"))
+	section := request.FormValue("section")
+	baseValue := request.FormValue("revision")
+
+	store := self.store(request)
+	history, err := store.History(title)
+	if err != nil {
+		return nil, 0, err
+	}
+	latest := len(history)
+	if section == "" && baseValue == "" {
+		return edited, latest, nil
+	}
+	current := []byte{}
+	page, err := store.Load(title)
+	if err == nil {
+		current, err = util.Source(page)
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	base := latest
+	if baseValue != "" {
+		if base, err = strconv.Atoi(baseValue); err != nil {
+			return nil, 0, fmt.Errorf("invalid revision %q", baseValue)
+		}
+	}
+	if section == "" {
+		if base != latest {
+			return nil, 0, errEditConflict
+		}
+		return edited, latest, nil
+	}
+
+	n, err := strconv.Atoi(section)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid section %q", section)
+	}
+	if base != latest {
+		original := []byte{}
+		if base > 0 {
+			old, err := store.Revision(title, base)
+			if err != nil {
+				return nil, 0, errEditConflict
+			}
+			if original, err = util.Source(old); err != nil {
+				return nil, 0, err
+			}
+		}
+		before, beforeErr := render.Section(original, n)
+		after, afterErr := render.Section(current, n)
+		if beforeErr != nil || afterErr != nil ||
+			!bytes.Equal(before, after) {
+			return nil, 0, errEditConflict
+		}
+	}
+	source, err := render.ReplaceSection(current, n, edited)
+	return source, latest, err
+}
+
+// editConflict answers 409 and hands the edit back so it is not lost.
+func editConflict(
+	writter http.ResponseWriter,
+	title string,
+	section string,
+	edited string) {
+	again := "/edit/" + title
+	if section != "" {
+		again += "?section=" + url.QueryEscape(section)
+	}
+	writter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writter.WriteHeader(http.StatusConflict)
+	fmt.Fprintf(writter, "<h1>Edit conflict on %s</h1>"+
+		"<p>Someone else changed this since you started editing. "+
+		"<a href=\"%s\">Edit again</a> and reapply your changes, "+
+		"which are below.</p><pre>%s</pre>", title, html.EscapeString(again),
+		html.EscapeString(edited))
+}
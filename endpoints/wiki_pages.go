@@ -1,23 +1,69 @@
 package endpoints
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/mehoggan/simple-wiki-web-app-go/audit"
+	"github.com/mehoggan/simple-wiki-web-app-go/cache"
 	"github.com/mehoggan/simple-wiki-web-app-go/config"
+	"github.com/mehoggan/simple-wiki-web-app-go/logging"
+	"github.com/mehoggan/simple-wiki-web-app-go/metrics"
+	"github.com/mehoggan/simple-wiki-web-app-go/ratelimit"
+	"github.com/mehoggan/simple-wiki-web-app-go/render"
+	"github.com/mehoggan/simple-wiki-web-app-go/spam"
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
 	"github.com/mehoggan/simple-wiki-web-app-go/templates"
 	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/users"
 	"github.com/mehoggan/simple-wiki-web-app-go/util"
+	"github.com/mehoggan/simple-wiki-web-app-go/webhooks"
 )
 
+const recentChangesLimit = 50
+const deliveryLogLimit = 100
+const defaultCacheSize = 1024
+const defaultSharedCacheTTL = time.Minute
+
+var tagsRegex = regexp.MustCompile("^/tags(?:/([a-zA-Z0-9_-]*))?$")
+
 type Endpoints struct {
 	Config     *types.Config
 	Templates  *templates.Templates
 	TitleRegex *regexp.Regexp
+	Webhooks   *webhooks.Dispatcher
+	Storage    storage.Storage
+	Cache      *cache.LRU
+	// Stamp tells when wikictl changed pages the cache holds.
+	Stamp      *cache.Stamp
+	Metrics    *metrics.Metrics
+	Logger     *slog.Logger
+	Audit      *audit.Log
+	ConfigPath string
+	Limiters   map[string]*ratelimit.Limiter
+	Spam       spam.Chain
+	Moderation *spam.Queue
+	Users      *users.Store
+	// FormKey signs when edit forms were served.
+	FormKey []byte
+	// Writes is held for reading by every page write and for writing by
+	// backups and restores, so those see a store nobody is changing.
+	Writes *sync.RWMutex
+	// Locks is held by a save from its conflict check to its write.
+	Locks *TitleLocks
 }
 
 func (self Endpoints) getTitle(
@@ -30,6 +76,91 @@ func (self Endpoints) getTitle(
 	return match[2], nil
 }
 
+func pageFromSource(title string, source []byte) (*types.Page, error) {
+	meta, body, err := util.ParseFrontMatter(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid front matter: %s", err)
+	}
+	return &types.Page{Title: title, Body: body, Meta: meta}, nil
+}
+
+func pageFromForm(request *http.Request, title string) (*types.Page, error) {
+	return pageFromSource(title, []byte(request.FormValue("body")))
+}
+
+func remoteHost(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// savePage is the single write path for handlers: it stores the revision,
+// audits it as action, keeps the tag index current and queues webhooks.
+// Once the revision is stored the edit has happened, so a failure to audit
+// it is logged and counted for alerting rather than reported to the editor.
+func (self Endpoints) savePage(
+	request *http.Request,
+	action string,
+	page *types.Page,
+	revision *types.Revision) error {
+	docRoot := self.Config.Server.DocRoot
+	store := self.store(request)
+	self.Writes.RLock()
+	defer self.Writes.RUnlock()
+	event := webhooks.PageUpdated
+	if _, err := store.Load(page.Title); err != nil {
+		event = webhooks.PageCreated
+	}
+	if err := store.Save(page, revision); err != nil {
+		return err
+	}
+	_, err := self.Audit.Append(audit.Entry{
+		User:        revision.Author,
+		IP:          remoteHost(request),
+		Action:      action,
+		Title:       page.Title,
+		OldRevision: revision.Number - 1,
+		NewRevision: revision.Number,
+		Timestamp:   revision.Timestamp})
+	if err != nil {
+		self.Metrics.ObserveAuditFailure()
+		logging.FromContext(request.Context()).Error(
+			"failed to audit a save", "action", action, "title", page.Title,
+			"revision", revision.Number, "error", err)
+	}
+	self.Cache.Invalidate(page.Title, revision.Number)
+	self.Cache.InvalidateIncludersOf(page.Title)
+	if event == webhooks.PageCreated {
+		self.Cache.InvalidateLinksTo(page.Title)
+	}
+	err = util.UpdateTagIndex(page.Title, util.PageTags(page), docRoot)
+	if err != nil {
+		return err
+	}
+	err = self.Webhooks.Fire(webhooks.Event{Type: event, Title: page.Title,
+		Revision: revision.Number, Timestamp: revision.Timestamp})
+	if err != nil {
+		logging.FromContext(request.Context()).Error(
+			"failed to queue webhooks", "event", event, "title", page.Title,
+			"error", err)
+	}
+	return nil
+}
+
+func (self Endpoints) renderOptions(request *http.Request) render.Options {
+	return render.Options{TOCThreshold: self.Config.Render.TOCThreshold,
+		Load: self.store(request).Load}
+}
+
+// store is Storage logging through the request's logger.
+func (self Endpoints) store(request *http.Request) storage.Storage {
+	return &storage.Logged{
+		Storage: self.Storage,
+		Logger:  logging.FromContext(request.Context())}
+}
+
 func (self Endpoints) MakeHandler(
 	fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
 	return func(writter http.ResponseWriter, request *http.Request) {
@@ -46,43 +177,142 @@ func (self Endpoints) ViewHandler(
 	writter http.ResponseWriter,
 	request *http.Request,
 	title string) {
-	log.Printf("Handling %s...", request.URL.Path)
-	docRoot := self.Config.Server.DocRoot
-	log.Printf("Going to load wiki page from %s", docRoot)
-	page, err := util.Load(title, docRoot)
-	if err != nil {
-		writter.WriteHeader(404)
-		fmt.Fprintf(writter, "<h1>Failed to find %s.txt.</h1>", title)
-	} else {
-		self.Templates.RenderTemplate(writter, "view", page)
+	if self.Stamp.Changed() {
+		self.Cache.Purge()
+	}
+	entry, ok := self.Cache.Get(title)
+	if !ok {
+		// Read the revision before the page so a concurrent save can only
+		// make the cached copy look older than it is, never newer. The
+		// generation covers included and linked pages the same way.
+		generation := self.Cache.Generation()
+		history, historyErr := self.store(request).History(title)
+		page, err := self.store(request).Load(title)
+		if err != nil {
+			writter.WriteHeader(404)
+			fmt.Fprintf(writter, "<h1>Failed to find %s.txt.</h1>", title)
+			return
+		}
+		options := self.renderOptions(request)
+		options.EditTitle = title
+		rendered, included := render.Page(page, options)
+		body, err := self.Templates.Render("view", rendered)
+		if err != nil {
+			http.Error(writter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entry = cache.Entry{
+			Revision:   len(history),
+			Generation: generation,
+			Links:      util.ExtractLinks(page.Body),
+			Includes:   included,
+			Body:       body}
+		// Included pages change without this page's revision moving, so
+		// only pages without any have a meaningful modification time.
+		if len(history) > 0 && len(included) == 0 {
+			entry.Modified = history[len(history)-1].Timestamp
+		}
+		if historyErr == nil {
+			self.Cache.Put(title, entry)
+		}
+	}
+
+	writter.Header().Set("Cache-Control", self.cacheControl())
+	if notModified(writter, request, self.viewETag(title, entry),
+		entry.Modified) {
+		return
 	}
+	writter.Write(entry.Body)
+}
+
+// viewETag is strong: it changes with the page revision and the templates.
+// Pages written outside the wiki have no revision, and pages that include
+// others change with them, so those fall back to a hash of the rendering.
+func (self Endpoints) viewETag(title string, entry cache.Entry) string {
+	revision := "r" + strconv.Itoa(entry.Revision)
+	if entry.Revision == 0 || len(entry.Includes) > 0 {
+		sum := sha256.Sum256(entry.Body)
+		revision = "h" + hex.EncodeToString(sum[:8])
+	}
+	return fmt.Sprintf("\"%s-%s-%s\"", title, revision,
+		self.Templates.Version)
 }
 
 func (self Endpoints) EditHandler(
 	writter http.ResponseWriter,
 	request *http.Request,
 	title string) {
-	log.Printf("Handling %s...", request.URL.Path)
-	docRoot := self.Config.Server.DocRoot
-	log.Printf("Going to load wiki page from %s", docRoot)
-	page, err := util.Load(title, docRoot)
+	// As in ViewHandler the revision is read first, so a save in between
+	// makes this form conflict instead of quietly overwriting it.
+	history, err := self.store(request).History(title)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page, err := self.store(request).Load(title)
 	if err != nil {
 		page = &types.Page{Title: title,
 			Body: []byte("Please insert your text...")}
 	}
-	self.Templates.RenderTemplate(writter, "edit", page)
+	// The textarea edits the page source, front matter included.
+	source, err := util.Source(page)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	section := request.URL.Query().Get("section")
+	if section != "" {
+		n, err := strconv.Atoi(section)
+		if err == nil {
+			source, err = render.Section(source, n)
+		}
+		if err != nil {
+			http.NotFound(writter, request)
+			return
+		}
+	}
+	self.Templates.RenderTemplate(writter, "edit", &types.EditForm{
+		Title: title, Body: source, Section: section,
+		Revision: len(history), Started: spam.Stamp(self.FormKey, time.Now())})
 }
 
 func (self Endpoints) SaveHandler(
 	writter http.ResponseWriter,
 	request *http.Request,
 	title string) {
-	log.Printf("Handling %s...", request.URL.Path)
-	body := request.FormValue("body")
-	page := &types.Page{Title: title, Body: []byte(body)}
-	docRoot := self.Config.Server.DocRoot
-	log.Printf("Going to save wiki page to %s", docRoot)
-	err := util.Save(page, docRoot)
+	if !parseForm(writter, request) {
+		return
+	}
+	defer self.Locks.Lock(title)()
+	source, base, err := self.editedSource(request, title)
+	if errors.Is(err, errEditConflict) {
+		editConflict(writter, title, request.FormValue("section"),
+			request.FormValue("body"))
+		return
+	} else if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(writter, request)
+		return
+	} else if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromSource(title, source)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	revision := &types.Revision{
+		Summary:   request.FormValue("summary"),
+		Minor:     request.FormValue("minor") != "",
+		Author:    remoteHost(request),
+		Timestamp: time.Now().UTC()}
+	err = self.Spam.Check(self.submission(request, title, source,
+		revision.Timestamp))
+	if err != nil {
+		self.hold(writter, request, title, source, base, revision, err)
+		return
+	}
+	err = self.savePage(request, audit.Save, page, revision)
 	if err != nil {
 		http.Redirect(writter, request, "/edit/"+title,
 			http.StatusInternalServerError)
@@ -91,15 +321,228 @@ func (self Endpoints) SaveHandler(
 	}
 }
 
+func (self Endpoints) RevertHandler(
+	writter http.ResponseWriter,
+	request *http.Request,
+	title string) {
+	if request.Method != http.MethodPost {
+		writter.Header().Set("Allow", http.MethodPost)
+		http.Error(writter, "Revert requires a POST.",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	if !parseForm(writter, request) {
+		return
+	}
+	number, err := strconv.Atoi(request.FormValue("revision"))
+	if err != nil {
+		http.Error(writter, "Invalid revision.", http.StatusBadRequest)
+		return
+	}
+	defer self.Locks.Lock(title)()
+	page, err := self.store(request).Revision(title, number)
+	if err != nil {
+		http.NotFound(writter, request)
+		return
+	}
+	revision := &types.Revision{
+		Summary:   fmt.Sprintf("Revert to r%d", number),
+		Author:    remoteHost(request),
+		Timestamp: time.Now().UTC()}
+	if err = self.savePage(request, audit.Revert, page, revision); err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(writter, request, "/view/"+title, http.StatusFound)
+}
+
+func (self Endpoints) PreviewHandler(
+	writter http.ResponseWriter,
+	request *http.Request,
+	title string) {
+	if request.Method != http.MethodPost {
+		writter.Header().Set("Allow", http.MethodPost)
+		http.Error(writter, "Preview requires a POST.",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	if !parseForm(writter, request) {
+		return
+	}
+	// Render exactly what ViewHandler would, but never touch the doc root.
+	page, err := pageFromForm(request, title)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rendered, _ := render.Page(page, self.renderOptions(request))
+	self.Templates.RenderTemplate(writter, "view", rendered)
+}
+
+func (self Endpoints) HistoryHandler(
+	writter http.ResponseWriter,
+	request *http.Request,
+	title string) {
+	revisions, err := self.store(request).History(title)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Newest first, like recent changes.
+	for i, j := 0, len(revisions)-1; i < j; i, j = i+1, j-1 {
+		revisions[i], revisions[j] = revisions[j], revisions[i]
+	}
+	history := &types.History{Title: title, Revisions: revisions}
+	self.Templates.RenderTemplate(writter, "history", history)
+}
+
+func (self Endpoints) RecentHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	hideMinor := request.URL.Query().Get("hideminor") != ""
+	revisions, err := self.store(request).RecentChanges(recentChangesLimit,
+		hideMinor)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recent := &types.RecentChanges{HideMinor: hideMinor, Revisions: revisions}
+	self.Templates.RenderTemplate(writter, "recent", recent)
+}
+
+func (self Endpoints) DeliveriesHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	deliveries, err := self.Webhooks.LoadLog(deliveryLogLimit)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	self.Templates.RenderTemplate(writter, "deliveries", deliveries)
+}
+
+func (self Endpoints) TagsHandler(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	match := tagsRegex.FindStringSubmatch(request.URL.Path)
+	if match == nil {
+		http.NotFound(writter, request)
+		return
+	}
+	index, err := util.LoadTagIndex(self.Config.Server.DocRoot)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tag := strings.ToLower(match[1])
+	if tag != "" {
+		tagged := &types.TaggedPages{Tag: tag, Titles: index[tag]}
+		self.Templates.RenderTemplate(writter, "tag", tagged)
+		return
+	}
+	counts := []types.TagCount{}
+	for tag, titles := range index {
+		counts = append(counts, types.TagCount{Tag: tag, Count: len(titles)})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Tag < counts[j].Tag
+	})
+	self.Templates.RenderTemplate(writter, "tags", counts)
+}
+
+func cacheSize(config *types.Config) int {
+	if config.Cache.Size == 0 {
+		return defaultCacheSize
+	}
+	return config.Cache.Size
+}
+
+func cacheTTL(config *types.Config) (time.Duration, error) {
+	if config.Cache.TTL == "" {
+		if config.Storage.Backend == "s3" {
+			return defaultSharedCacheTTL, nil
+		}
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(config.Cache.TTL)
+	if err == nil && ttl < 0 {
+		err = fmt.Errorf("cache ttl %s is negative", ttl)
+	}
+	return ttl, err
+}
+
 var endpoints *Endpoints
 var once sync.Once
 
 func InitializeEndpoints(configPath string) *Endpoints {
 	once.Do(func() {
 		config := config.Intantiate(configPath)
+		logger, err := logging.New(config.Log, os.Stderr)
+		if err != nil {
+			log.Fatalf("Failed to configure logging with %s!!!", err)
+		}
+		slog.SetDefault(logger)
 		templates := templates.InstantiateTemplates(configPath)
-		regex := regexp.MustCompile("^/(edit|save|view)/([a-zA-Z0-9]+)$")
-		endpoints = &Endpoints{config, templates, regex}
+		regex := regexp.MustCompile(
+			"^/(edit|save|view|preview|history|revert)/([a-zA-Z0-9]+)$")
+		store, err := storage.New(config)
+		if err != nil {
+			log.Fatalf("Failed to open %s storage with %s!!!",
+				config.Storage.Backend, err)
+		}
+		collector := metrics.New()
+		store = &storage.Instrumented{Storage: store, Observer: collector}
+		chain, err := spam.NewChain(config.Spam)
+		if err != nil {
+			log.Fatalf("Failed to configure spam filters with %s!!!", err)
+		}
+		limiters, err := newLimiters(config)
+		if err != nil {
+			log.Fatalf("Failed to configure rate limits with %s!!!", err)
+		}
+		formKey, err := spam.LoadKey(config.Server.DocRoot)
+		if err != nil {
+			log.Fatalf("Failed to load the edit form key with %s!!!", err)
+		}
+		lru := cache.NewLRU(cacheSize(config))
+		lru.TTL, err = cacheTTL(config)
+		if err != nil {
+			log.Fatalf("Failed to configure the page cache with %s!!!", err)
+		}
+		collector.RegisterPageCount(store.Titles)
+		collector.RegisterCache(lru)
+		dispatcher := webhooks.NewDispatcher(config.Webhooks,
+			config.Server.DocRoot)
+		if len(config.Webhooks) > 0 {
+			go dispatcher.Run(nil)
+		}
+		endpoints = &Endpoints{
+			Config:     config,
+			Templates:  templates,
+			TitleRegex: regex,
+			Webhooks:   dispatcher,
+			Storage:    store,
+			Cache:      lru,
+			Stamp:      cache.NewStamp(config.Server.DocRoot),
+			Metrics:    collector,
+			Logger:     logger,
+			Audit:      audit.NewLog(config.Server.DocRoot),
+			ConfigPath: configPath,
+			Limiters:   limiters,
+			Spam:       chain,
+			Moderation: spam.NewQueue(config.Server.DocRoot),
+			Users:      users.NewStore(config.Server.DocRoot),
+			FormKey:    formKey,
+			Writes:     &sync.RWMutex{},
+			Locks:      NewTitleLocks()}
+		if config.Backup.Dir != "" && config.Backup.Interval != "" {
+			scheduler, err := endpoints.backupScheduler()
+			if err != nil {
+				log.Fatalf("Failed to schedule backups with %s!!!", err)
+			}
+			go scheduler.Run(nil)
+		}
 	})
 	return endpoints
 }
@@ -1,17 +1,27 @@
 package endpoints
 
 import (
+	"archive/zip"
+	"bytes"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/mehoggan/simple-wiki-web-app-go/audit"
+	"github.com/mehoggan/simple-wiki-web-app-go/backup"
+	"github.com/mehoggan/simple-wiki-web-app-go/ratelimit"
+	"github.com/mehoggan/simple-wiki-web-app-go/spam"
 	"github.com/mehoggan/simple-wiki-web-app-go/types"
 	"github.com/mehoggan/simple-wiki-web-app-go/util"
 	"github.com/stretchr/testify/assert"
@@ -73,6 +83,13 @@ func generatePage(rootPath string, title string, t *testing.T) string {
 	return ret
 }
 
+var stampRegex = regexp.MustCompile(`name="started"value="[0-9a-f.]+"`)
+
+// withoutStamp blanks the form stamp, which changes with the clock.
+func withoutStamp(str string) string {
+	return stampRegex.ReplaceAllString(str, `name="started"value="STAMP"`)
+}
+
 func cleanString(str string) string {
 	str = strings.ReplaceAll(str, " ", "")
 	str = strings.ReplaceAll(str, "\n", "")
@@ -95,7 +112,7 @@ func TestBadEndpoint(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/viev/ABC", nil)
 	rec := httptest.NewRecorder()
-	endpoints.ViewHandler(rec, req, "view")
+	endpoints.MakeHandler(endpoints.ViewHandler)(rec, req)
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -152,7 +169,7 @@ func TestViewHandlerSuccess(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/view/ABC", nil)
 	rec := httptest.NewRecorder()
-	endpoints.ViewHandler(rec, req, "view")
+	endpoints.ViewHandler(rec, req, "ABC")
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -178,12 +195,14 @@ func TestViewHandlerSuccess(t *testing.T) {
 }
 
 func TestViewHandlerPageDNE(t *testing.T) {
-	// We do not create the page here.
+	// We do not create the page here, and earlier tests removed theirs
+	// behind the cache's back.
 	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	endpoints.Cache.Purge()
 
 	req := httptest.NewRequest(http.MethodGet, "/view/ABC", nil)
 	rec := httptest.NewRecorder()
-	endpoints.ViewHandler(rec, req, "view")
+	endpoints.ViewHandler(rec, req, "ABC")
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -208,7 +227,7 @@ func TestEditHandlerSuccess(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/edit/ABC", nil)
 	rec := httptest.NewRecorder()
-	endpoints.EditHandler(rec, req, "edit")
+	endpoints.EditHandler(rec, req, "ABC")
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -216,7 +235,7 @@ func TestEditHandlerSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Expected error to be nil got %s.", err)
 	}
-	actualData := cleanString(string(actualByteData))
+	actualData := withoutStamp(cleanString(string(actualByteData)))
 	expectedData := `<h1>Editing ABC</h1>
 		<form action="/save/ABC" method="POST">
 			<div>
@@ -224,10 +243,33 @@ func TestEditHandlerSuccess(t *testing.T) {
 					This is a sample page.
 				</textarea>
 			</div>
+			<div>
+				<label>
+					Summary
+					<input type="text" name="summary" size="60">
+				</label>
+				<label>
+					<input type="checkbox" name="minor">
+					This is a minor edit
+				</label>
+			</div>
+			<input type="hidden" name="section" value="">
+			<input type="hidden" name="revision" value="0">
+			<input type="hidden" name="started" value="STAMP">
+			<div style="display:none">
+				<label>
+					Leave this empty
+					<input type="text" name="website" tabindex="-1"
+						autocomplete="off">
+				</label>
+			</div>
 			<div>
 				<input type="submit" value="Save">
+				<input type="submit" value="Preview"
+					formaction="/preview/ABC" formtarget="preview">
 			</div>
-		</form>`
+		</form>
+		<iframe name="preview" title="Preview"></iframe>`
 	expectedData = cleanString(expectedData)
 	assert.Equalf(t, expectedData, actualData,
 		"The response (actual) data %s != %s (expected).",
@@ -242,7 +284,7 @@ func TestEditHandlerPageDNE(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodGet, "/view/ABC", nil)
 	rec := httptest.NewRecorder()
-	endpoints.EditHandler(rec, req, "edit")
+	endpoints.EditHandler(rec, req, "ABC")
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -250,17 +292,40 @@ func TestEditHandlerPageDNE(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Expected error to be nil got %s.", err)
 	}
-	actualData := cleanString(string(actualByteData))
+	actualData := withoutStamp(cleanString(string(actualByteData)))
 	expectedData := cleanString(`<h1>Editing ABC</h1>
 		<form action="/save/ABC" method="POST">
 			<div>
 				<textarea name="body" rows="20" cols="80">Please insert your text...
 				</textarea>
 			</div>
+			<div>
+				<label>
+					Summary
+					<input type="text" name="summary" size="60">
+				</label>
+				<label>
+					<input type="checkbox" name="minor">
+					This is a minor edit
+				</label>
+			</div>
+			<input type="hidden" name="section" value="">
+			<input type="hidden" name="revision" value="0">
+			<input type="hidden" name="started" value="STAMP">
+			<div style="display:none">
+				<label>
+					Leave this empty
+					<input type="text" name="website" tabindex="-1"
+						autocomplete="off">
+				</label>
+			</div>
 			<div>
 				<input type="submit" value="Save">
+				<input type="submit" value="Preview"
+					formaction="/preview/ABC" formtarget="preview">
 			</div>
-		</form>`)
+		</form>
+		<iframe name="preview" title="Preview"></iframe>`)
 	assert.Equalf(t, 200, res.StatusCode, "Expected a 200, but got a %d",
 		res.StatusCode)
 	assert.Equalf(t, expectedData, actualData,
@@ -271,12 +336,39 @@ func TestEditHandlerPageDNE(t *testing.T) {
 func TestSaveHandlerSuccess(t *testing.T) {
 	pageDataPath := generatePage(*rootPath, "ABC", t)
 	defer os.Remove(pageDataPath)
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
 
 	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
 
-	req := httptest.NewRequest(http.MethodGet, "/edit/ABC", nil)
+	form := url.Values{"body": {"This is a saved page."}}
+	req := httptest.NewRequest(http.MethodPost, "/save/ABC",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	endpoints.SaveHandler(rec, req, "ABC")
+
+	res := rec.Result()
+	defer res.Body.Close()
+	// Redirects after a POST have no body to compare.
+	assert.Equal(t, "/view/ABC", res.Header.Get("Location"))
+	assert.Equalf(t, 302, res.StatusCode, "Expected a 302, but got a %d",
+		res.StatusCode)
+	page, err := util.Load("ABC", *rootPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "This is a saved page.", string(page.Body))
+}
+
+func TestPreviewHandlerSuccess(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+
+	form := url.Values{"body": {"This is a preview."}}
+	req := httptest.NewRequest(http.MethodPost, "/preview/Preview",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rec := httptest.NewRecorder()
-	endpoints.SaveHandler(rec, req, "edit")
+	previewHandler := endpoints.MakeHandler(endpoints.PreviewHandler)
+	previewHandler(rec, req)
 
 	res := rec.Result()
 	defer res.Body.Close()
@@ -285,13 +377,705 @@ func TestSaveHandlerSuccess(t *testing.T) {
 		t.Fatalf("Expected error to be nil got %s.", err)
 	}
 	actualData := cleanString(string(actualByteData))
-	expectedData := `<ahref="/edit/ABC">Found</a>.`
-	expectedData = cleanString(expectedData)
+	expectedData := cleanString(`<h1>Preview</h1>
+		<p>
+			<ahref="/edit/Preview">
+				edit
+			</a>
+		</p>
+		<div>
+			This is a preview.
+		</div>`)
 	assert.Equalf(t, expectedData, actualData,
 		"The response (actual) data %s != %s (expected).",
 		actualData, expectedData)
-	assert.Equalf(t, 302, res.StatusCode, "Expected a 200, but got a %d",
+	assert.Equalf(t, 200, res.StatusCode, "Expected a 200, but got a %d",
+		res.StatusCode)
+	previewPath := path.Join(*rootPath, "Preview.txt")
+	assert.Falsef(t, util.Exists(previewPath),
+		"Preview should not have saved %s.", previewPath)
+}
+
+func TestPreviewHandlerRequiresPost(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+
+	req := httptest.NewRequest(http.MethodGet, "/preview/Preview", nil)
+	rec := httptest.NewRecorder()
+	previewHandler := endpoints.MakeHandler(endpoints.PreviewHandler)
+	previewHandler(rec, req)
+
+	res := rec.Result()
+	defer res.Body.Close()
+	assert.Equalf(t, 405, res.StatusCode, "Expected a 405, but got a %d",
 		res.StatusCode)
+	assert.Equal(t, http.MethodPost, res.Header.Get("Allow"))
+}
+
+func TestSaveHandlerRecordsSummary(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, "Summary.txt"))
+
+	form := url.Values{"body": {"Edited."}, "summary": {"Fix <typo>"},
+		"minor": {"on"}}
+	req := httptest.NewRequest(http.MethodPost, "/save/Summary",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.SaveHandler)(rec, req)
+	assert.Equalf(t, 302, rec.Result().StatusCode,
+		"Expected a 302, but got a %d", rec.Result().StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/history/Summary", nil)
+	rec = httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.HistoryHandler)(rec, req)
+	actualData := cleanString(rec.Body.String())
+	assert.Contains(t, actualData, "<h1>HistoryofSummary</h1>")
+	assert.Contains(t, actualData, "r1")
+	assert.Contains(t, actualData, "<b>m</b>192.0.2.1Fix&lt;typo&gt;")
+
+	req = httptest.NewRequest(http.MethodGet, "/recent", nil)
+	rec = httptest.NewRecorder()
+	endpoints.RecentHandler(rec, req)
+	actualData = cleanString(rec.Body.String())
+	assert.Contains(t, actualData, `<ahref="/view/Summary">Summary</a>`)
+
+	req = httptest.NewRequest(http.MethodGet, "/recent?hideminor=1", nil)
+	rec = httptest.NewRecorder()
+	endpoints.RecentHandler(rec, req)
+	actualData = cleanString(rec.Body.String())
+	assert.NotContains(t, actualData, `<ahref="/view/Summary">Summary</a>`)
+	assert.Contains(t, actualData, `<ahref="/recent">Showminoredits</a>`)
+}
+
+func TestDeliveriesHandler(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks/deliveries", nil)
+	rec := httptest.NewRecorder()
+	endpoints.DeliveriesHandler(rec, req)
+
+	res := rec.Result()
+	assert.Equalf(t, 200, res.StatusCode, "Expected a 200, but got a %d",
+		res.StatusCode)
+	assert.Contains(t, cleanString(rec.Body.String()),
+		"<h1>Webhookdeliveries</h1>")
+}
+
+func TestTagsHandler(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Tagged.txt"))
+
+	form := url.Values{"body": {"Runbook [[Tag:Ops]] [[Tag:oncall]]"}}
+	req := httptest.NewRequest(http.MethodPost, "/save/Tagged",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.SaveHandler)(rec, req)
+
+	req = httptest.NewRequest(http.MethodGet, "/tags", nil)
+	rec = httptest.NewRecorder()
+	endpoints.TagsHandler(rec, req)
+	actualData := cleanString(rec.Body.String())
+	assert.Contains(t, actualData, `<ahref="/tags/ops">ops</a>(1)`)
+	assert.Contains(t, actualData, `<ahref="/tags/oncall">oncall</a>(1)`)
+	assert.Contains(t, viewPage(endpoints, "Tagged"),
+		`Runbook<ahref="/tags/ops">Ops</a><ahref="/tags/oncall">oncall</a>`)
+
+	req = httptest.NewRequest(http.MethodGet, "/tags/OPS", nil)
+	rec = httptest.NewRecorder()
+	endpoints.TagsHandler(rec, req)
+	actualData = cleanString(rec.Body.String())
+	assert.Contains(t, actualData, "<h1>Pagestaggedops</h1>")
+	assert.Contains(t, actualData, `<li><ahref="/view/Tagged">Tagged</a></li>`)
+
+	req = httptest.NewRequest(http.MethodGet, "/tagsops", nil)
+	rec = httptest.NewRecorder()
+	endpoints.TagsHandler(rec, req)
+	assert.Equal(t, 404, rec.Result().StatusCode)
+}
+
+func TestFrontMatterRoundTrip(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Meta.txt"))
+
+	source := "---\nowner: ops\ntags: [runbook]\n---\nMeta body."
+	form := url.Values{"body": {source}}
+	req := httptest.NewRequest(http.MethodPost, "/save/Meta",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.SaveHandler)(rec, req)
+	assert.Equal(t, 302, rec.Result().StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/view/Meta", nil)
+	rec = httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.ViewHandler)(rec, req)
+	actualData := cleanString(rec.Body.String())
+	assert.Contains(t, actualData, "<dt>owner</dt><dd>ops</dd>")
+	assert.Contains(t, actualData, "<div>Metabody.</div>")
+
+	req = httptest.NewRequest(http.MethodGet, "/edit/Meta", nil)
+	rec = httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.EditHandler)(rec, req)
+	assert.Contains(t, rec.Body.String(), "owner: ops")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/pages/Meta", nil)
+	rec = httptest.NewRecorder()
+	endpoints.APIPageHandler(rec, req)
+	assert.Equal(t, 200, rec.Result().StatusCode)
+	assert.JSONEq(t, `{"title": "Meta", "body": "Meta body.",
+		"meta": {"owner": "ops", "tags": ["runbook"]},
+		"tags": ["runbook"]}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/pages/Missing", nil)
+	rec = httptest.NewRecorder()
+	endpoints.APIPageHandler(rec, req)
+	assert.Equal(t, 404, rec.Result().StatusCode)
+}
+
+func TestSaveHandlerRejectsBadFrontMatter(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+
+	form := url.Values{"body": {"---\nowner: ops\nno closing line"}}
+	req := httptest.NewRequest(http.MethodPost, "/save/BadMeta",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.SaveHandler)(rec, req)
+	assert.Equal(t, 400, rec.Result().StatusCode)
+	assert.False(t, util.Exists(path.Join(*rootPath, "BadMeta.txt")))
+}
+
+func TestRevertHandler(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Revert.txt"))
+	for _, body := range []string{"Good.", "Vandalism."} {
+		form := url.Values{"body": {body}}
+		req := httptest.NewRequest(http.MethodPost, "/save/Revert",
+			strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		endpoints.MakeHandler(endpoints.SaveHandler)(
+			httptest.NewRecorder(), req)
+	}
+
+	form := url.Values{"revision": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/revert/Revert",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.RevertHandler)(rec, req)
+	assert.Equal(t, 302, rec.Result().StatusCode)
+
+	page, err := util.Load("Revert", *rootPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "Good.", string(page.Body))
+	history, _ := util.LoadHistory("Revert", *rootPath)
+	assert.Equal(t, 3, len(history))
+	assert.Equal(t, "Revert to r1", history[2].Summary)
+
+	form = url.Values{"revision": {"9"}}
+	req = httptest.NewRequest(http.MethodPost, "/revert/Revert",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.RevertHandler)(rec, req)
+	assert.Equal(t, 404, rec.Result().StatusCode)
+}
+
+func savePageForm(endpoints *Endpoints, title string, body string) int {
+	form := url.Values{"body": {body}}
+	req := httptest.NewRequest(http.MethodPost, "/save/"+title,
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.SaveHandler)(rec, req)
+	return rec.Result().StatusCode
+}
+
+func viewPage(endpoints *Endpoints, title string) string {
+	req := httptest.NewRequest(http.MethodGet, "/view/"+title, nil)
+	rec := httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.ViewHandler)(rec, req)
+	return cleanString(rec.Body.String())
+}
+
+func TestViewHandlerCachesRenderedPages(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Cached.txt"))
+	defer os.Remove(path.Join(*rootPath, "CacheTarget.txt"))
+
+	savePageForm(endpoints, "Cached", "First [[CacheTarget]].")
+	before := endpoints.Cache.Stats()
+	assert.Contains(t, viewPage(endpoints, "Cached"), "First")
+	assert.Contains(t, viewPage(endpoints, "Cached"), "First")
+	after := endpoints.Cache.Stats()
+	assert.Equal(t, before.Misses+1, after.Misses)
+	assert.Equal(t, before.Hits+1, after.Hits)
+
+	// Saving replaces the cached rendering.
+	savePageForm(endpoints, "Cached", "Second [[CacheTarget]].")
+	assert.Contains(t, viewPage(endpoints, "Cached"), "Second")
+
+	// Creating a page it links to drops it as well.
+	viewPage(endpoints, "Cached")
+	_, ok := endpoints.Cache.Get("Cached")
+	assert.True(t, ok)
+	savePageForm(endpoints, "CacheTarget", "Now I exist.")
+	_, ok = endpoints.Cache.Get("Cached")
+	assert.False(t, ok)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/cache", nil)
+	rec := httptest.NewRecorder()
+	endpoints.CacheStatsHandler(rec, req)
+	assert.Contains(t, rec.Body.String(), `"capacity":1024`)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Measured.txt"))
+
+	routes := endpoints.Routes()
+	savePageForm(endpoints, "Measured", "Counted.")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+		"/view/Measured", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body,
+		`wiki_http_requests_total{code="200",handler="view"}`)
+	assert.Contains(t, body, `wiki_http_request_duration_seconds_count{handler="view"}`)
+	assert.Contains(t, body, `wiki_storage_operation_duration_seconds_count{operation="load"}`)
+	assert.Contains(t, body, "wiki_pages ")
+	assert.Contains(t, body, "wiki_cache_hits_total ")
+}
+
+func TestAuditHandler(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.RemoveAll(path.Join(*rootPath, ".audit"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Audited.txt"))
+
+	savePageForm(endpoints, "Audited", "Watched.")
+	entries, err := endpoints.Audit.Load(audit.Filter{Title: "Audited"}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, audit.Save, entries[0].Action)
+	assert.Equal(t, 1, entries[0].NewRevision)
+	assert.Equal(t, "192.0.2.1", entries[0].IP)
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/admin/audit?title=Audited&action=save", nil)
+	rec := httptest.NewRecorder()
+	endpoints.AuditHandler(rec, req)
+	body := cleanString(rec.Body.String())
+	assert.Contains(t, body, "Hashchainverified.")
+	assert.Contains(t, body, "<td>Audited</td>")
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/audit?since=never", nil)
+	rec = httptest.NewRecorder()
+	endpoints.AuditHandler(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestExportHandler(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.RemoveAll(path.Join(*rootPath, ".audit"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Exported.txt"))
+
+	savePageForm(endpoints, "Exported", "Published.")
+	req := httptest.NewRequest(http.MethodGet, "/admin/export?prefix=Exp", nil)
+	rec := httptest.NewRecorder()
+	endpoints.ExportHandler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()),
+		int64(rec.Body.Len()))
+	assert.NoError(t, err)
+	assert.Equal(t, "Exported.html", archive.File[0].Name)
+}
+
+func TestBackupAndRestoreHandlers(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.RemoveAll(path.Join(*rootPath, ".audit"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Backedup.txt"))
+
+	savePageForm(endpoints, "Backedup", "Kept. [[Tag:restored]]")
+	req := httptest.NewRequest(http.MethodGet, "/admin/backup", nil)
+	rec := httptest.NewRecorder()
+	endpoints.BackupHandler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/gzip", rec.Header().Get("Content-Type"))
+	archive := rec.Body.Bytes()
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/restore?mode=merge",
+		bytes.NewReader(archive))
+	rec = httptest.NewRecorder()
+	os.Remove(path.Join(*rootPath, ".tags.json"))
+	endpoints.RestoreHandler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Backedup")
+	tags, err := util.LoadTagIndex(*rootPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Backedup"}, tags["restored"])
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/restore",
+		bytes.NewReader(archive[:len(archive)/2]))
+	rec = httptest.NewRecorder()
+	endpoints.RestoreHandler(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAdminRoutes(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.Remove(path.Join(*rootPath, backup.UsersFile))
+	assert.NoError(t, endpoints.Users.Create("root", "secret", true))
+	assert.NoError(t, endpoints.Users.Create("editor", "secret", false))
+	routes := endpoints.Routes()
+
+	get := func(target string, name string, password string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if name != "" {
+			req.SetBasicAuth(name, password)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, target := range []string{"/admin/audit", "/admin/export",
+		"/admin/backup", "/admin/moderation", "/admin/unknown",
+		"/webhooks/deliveries"} {
+		assert.Equal(t, http.StatusUnauthorized, get(target, "", ""), target)
+	}
+	assert.Equal(t, http.StatusUnauthorized,
+		get("/admin/audit", "root", "wrong"))
+	assert.Equal(t, http.StatusForbidden, get("/admin/audit", "editor", "secret"))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/backup", nil)
+	req.SetBasicAuth("root", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	archive, err := backup.Read(rec.Body)
+	assert.NoError(t, err)
+	assert.NotContains(t, archive.Files, backup.UsersFile)
+	assert.Nil(t, archive.Config)
+
+	// Posts need a token as well as the credentials the browser resends.
+	discard := func(token string) int {
+		form := url.Values{"id": {"unknown"}, "csrf": {token}}
+		req := httptest.NewRequest(http.MethodPost,
+			"/admin/moderation/discard", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("root", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusForbidden, discard(""))
+	forged := spam.Stamp(endpoints.tokenKey("editor"), time.Now())
+	assert.Equal(t, http.StatusForbidden, discard(forged))
+	expired := spam.Stamp(endpoints.tokenKey("root"),
+		time.Now().Add(-tokenLifetime-time.Minute))
+	assert.Equal(t, http.StatusForbidden, discard(expired))
+	req = httptest.NewRequest(http.MethodGet, "/admin/token", nil)
+	req.SetBasicAuth("root", "secret")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound,
+		discard(strings.TrimSpace(rec.Body.String())))
+}
+
+func TestSaveSurvivesAuditFailure(t *testing.T) {
+	unaudited := *InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Unaudited.txt"))
+	// The audit log cannot be created under a regular file.
+	unaudited.Audit = audit.NewLog(path.Join(*rootPath, "settings.yaml"))
+
+	assert.Equal(t, http.StatusFound,
+		savePageForm(&unaudited, "Unaudited", "Saved anyway."))
+	page, err := unaudited.Storage.Load("Unaudited")
+	assert.NoError(t, err)
+	assert.Equal(t, "Saved anyway.", string(page.Body))
+}
+
+func TestLimit(t *testing.T) {
+	limited := *InitializeEndpoints(generateConfigFile())
+	limited.Limiters = map[string]*ratelimit.Limiter{
+		"preview": ratelimit.New(1, 1)}
+	handler := limited.Limit("preview",
+		limited.MakeHandler(limited.PreviewHandler))
+
+	oversized := url.Values{"body": {strings.Repeat("x", defaultMaxBodyBytes)}}
+	req := httptest.NewRequest(http.MethodPost, "/preview/Limited",
+		strings.NewReader(oversized.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/preview/Limited",
+		strings.NewReader("body=Small."))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+
+	req.RemoteAddr = "203.0.113.9:1234"
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	_, err := newLimiters(&types.Config{Limits: types.Limits{
+		Rates: map[string]types.RateLimit{"save": {PerMinute: 0}}}})
+	assert.ErrorContains(t, err, "per_minute must be positive")
+}
+
+func TestCacheTTL(t *testing.T) {
+	ttl, err := cacheTTL(&types.Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+	ttl, err = cacheTTL(&types.Config{Storage: types.Storage{Backend: "s3"}})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultSharedCacheTTL, ttl)
+	ttl, err = cacheTTL(&types.Config{Storage: types.Storage{Backend: "s3"},
+		Cache: types.Cache{TTL: "10s"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, ttl)
+	_, err = cacheTTL(&types.Config{Cache: types.Cache{TTL: "-1s"}})
+	assert.ErrorContains(t, err, "negative")
+}
+
+func TestModeration(t *testing.T) {
+	moderated := *InitializeEndpoints(generateConfigFile())
+	moderated.Spam = spam.Chain{spam.LinkCount{Max: 0}}
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.RemoveAll(path.Join(*rootPath, ".audit"))
+	defer os.RemoveAll(path.Join(*rootPath, ".moderation"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Held.txt"))
+
+	assert.Equal(t, http.StatusAccepted,
+		savePageForm(&moderated, "Held", "Visit http://spam.example."))
+	assert.False(t, util.Exists(path.Join(*rootPath, "Held.txt")))
+	held, err := moderated.Moderation.List()
+	assert.NoError(t, err)
+	assert.Len(t, held, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/moderation", nil)
+	rec := httptest.NewRecorder()
+	moderated.ModerationHandler(rec, req)
+	assert.Contains(t, rec.Body.String(), held[0].ID)
+	assert.Contains(t, rec.Body.String(), `name="csrf"`)
+
+	form := url.Values{"id": {held[0].ID}}
+	req = httptest.NewRequest(http.MethodPost, "/admin/moderation/approve",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	moderated.ModerationHandler(rec, req)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.True(t, util.Exists(path.Join(*rootPath, "Held.txt")))
+	held, err = moderated.Moderation.List()
+	assert.NoError(t, err)
+	assert.Empty(t, held)
+
+	entries, err := moderated.Audit.Load(audit.Filter{Title: "Held"}, 0)
+	assert.NoError(t, err)
+	actions := []string{}
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{audit.Approve, audit.Save, audit.Hold}, actions)
+
+	// An approval made stale by a later save conflicts.
+	savePageForm(&moderated, "Held", "Spam again: http://spam.example.")
+	held, err = moderated.Moderation.List()
+	assert.NoError(t, err)
+	assert.Len(t, held, 1)
+	moderated.Spam = spam.Chain{}
+	savePageForm(&moderated, "Held", "Cleaned up.")
+	form = url.Values{"id": {held[0].ID}}
+	req = httptest.NewRequest(http.MethodPost, "/admin/moderation/approve",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	moderated.ModerationHandler(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestCrossSitePostsRefused(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "CrossSite.txt"))
+	routes := endpoints.Routes()
+	post := func(target string, site string) int {
+		form := url.Values{"body": {"Posted."}}
+		req := httptest.NewRequest(http.MethodPost, target,
+			strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Sec-Fetch-Site", site)
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, target := range []string{"/save/CrossSite", "/preview/CrossSite",
+		"/revert/CrossSite", "/admin/moderation/discard"} {
+		assert.Equal(t, http.StatusForbidden, post(target, "cross-site"),
+			target)
+	}
+	assert.False(t, util.Exists(path.Join(*rootPath, "CrossSite.txt")))
+	assert.Equal(t, http.StatusFound, post("/save/CrossSite", "same-origin"))
+	assert.True(t, util.Exists(path.Join(*rootPath, "CrossSite.txt")))
+}
+
+func TestSubmissionStarted(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	served := time.Now().Add(-time.Minute).Truncate(time.Second)
+	submission := func(started string) spam.Submission {
+		req := httptest.NewRequest(http.MethodPost, "/save/Stamped",
+			strings.NewReader(url.Values{"started": {started}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return endpoints.submission(req, "Stamped", nil, time.Now())
+	}
+	assert.True(t,
+		served.Equal(submission(spam.Stamp(endpoints.FormKey, served)).Started))
+	assert.True(t, submission("1").Started.IsZero())
+	forged := spam.Stamp([]byte("forged"), served)
+	assert.True(t, submission(forged).Started.IsZero())
+}
+
+func TestViewHandlerRendersSections(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.RemoveAll(path.Join(*rootPath, ".audit"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Sectioned.txt"))
+
+	savePageForm(endpoints, "Sectioned",
+		"[[_TOC_]]<h2>Deploy Steps</h2>See [[Sectioned#Deploy Steps]].")
+	view := viewPage(endpoints, "Sectioned")
+	assert.Contains(t, view, `<ahref="#deploy-steps">DeploySteps</a>`)
+	assert.Contains(t, view, `<h2id="deploy-steps">DeploySteps</h2>`)
+	assert.Contains(t, view,
+		`<ahref="/view/Sectioned#deploy-steps">Sectioned</a>`)
+}
+
+func saveSection(
+	endpoints *Endpoints,
+	title string,
+	section string,
+	revision string,
+	body string) *httptest.ResponseRecorder {
+	form := url.Values{"body": {body}, "section": {section},
+		"revision": {revision}}
+	req := httptest.NewRequest(http.MethodPost, "/save/"+title,
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.SaveHandler)(rec, req)
+	return rec
+}
+
+func TestSectionEditing(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.RemoveAll(path.Join(*rootPath, ".audit"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Runbook.txt"))
+
+	savePageForm(endpoints, "Runbook", "Lead\n<h2>One</h2>\n1\n<h2>Two</h2>\n2\n")
+	req := httptest.NewRequest(http.MethodGet, "/edit/Runbook?section=2", nil)
+	rec := httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.EditHandler)(rec, req)
+	assert.Contains(t, rec.Body.String(), "&lt;h2&gt;Two&lt;/h2&gt;\n2\n")
+	assert.NotContains(t, rec.Body.String(), "<h2>One</h2>")
+	assert.Contains(t, rec.Body.String(),
+		`<input type="hidden" name="revision" value="1">`)
+
+	req = httptest.NewRequest(http.MethodGet, "/edit/Runbook?section=9", nil)
+	rec = httptest.NewRecorder()
+	endpoints.MakeHandler(endpoints.EditHandler)(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Someone else edits section 1 in the meantime, which does not touch
+	// section 2.
+	rec = saveSection(endpoints, "Runbook", "1", "1", "<h2>One</h2>\nuno")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	rec = saveSection(endpoints, "Runbook", "2", "1", "<h2>Two</h2>\ndos")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	page, err := endpoints.Storage.Load("Runbook")
+	assert.NoError(t, err)
+	assert.Equal(t, "Lead\n<h2>One</h2>\nuno\n<h2>Two</h2>\ndos\n",
+		string(page.Body))
+
+	// A stale edit of a section that did change is refused.
+	rec = saveSection(endpoints, "Runbook", "2", "1", "<h2>Two</h2>\nzwei")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "zwei")
+	rec = saveSection(endpoints, "Runbook", "", "2", "Whole page.")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	page, _ = endpoints.Storage.Load("Runbook")
+	assert.Contains(t, string(page.Body), "dos")
+
+	// Concurrent edits of different sections both land.
+	var group sync.WaitGroup
+	for section, body := range map[string]string{
+		"1": "<h2>One</h2>\neins", "2": "<h2>Two</h2>\nzwei"} {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			rec := saveSection(endpoints, "Runbook", section, "3", body)
+			assert.Equal(t, http.StatusFound, rec.Code)
+		}()
+	}
+	group.Wait()
+	page, _ = endpoints.Storage.Load("Runbook")
+	assert.Equal(t, "Lead\n<h2>One</h2>\neins\n<h2>Two</h2>\nzwei\n",
+		string(page.Body))
+}
+
+func TestViewHandlerTranscludes(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.RemoveAll(path.Join(*rootPath, ".audit"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Includer.txt"))
+	defer os.Remove(path.Join(*rootPath, "TemplateOncall.txt"))
+
+	savePageForm(endpoints, "TemplateOncall", "Page {{{team|ops}}} now.")
+	savePageForm(endpoints, "Includer", "{{Template:Oncall|team=infra}}")
+	assert.Contains(t, viewPage(endpoints, "Includer"), "Pageinfranow.")
+	_, ok := endpoints.Cache.Get("Includer")
+	assert.True(t, ok)
+
+	savePageForm(endpoints, "TemplateOncall", "Call {{{team|ops}}} now.")
+	_, ok = endpoints.Cache.Get("Includer")
+	assert.False(t, ok)
+	assert.Contains(t, viewPage(endpoints, "Includer"), "Callinfranow.")
 }
 
 func TestMain(m *testing.M) {
@@ -301,3 +1085,15 @@ func TestMain(m *testing.M) {
 	tearDown()
 	os.Exit(retCode)
 }
+
+func TestViewSanitizesPages(t *testing.T) {
+	var endpoints *Endpoints = InitializeEndpoints(generateConfigFile())
+	defer os.RemoveAll(path.Join(*rootPath, ".revisions"))
+	defer os.Remove(path.Join(*rootPath, ".tags.json"))
+	defer os.Remove(path.Join(*rootPath, "Scripted.txt"))
+	savePageForm(endpoints, "Scripted",
+		`<p>Hello</p><script>fetch("/admin/token")</script>`)
+	viewed := viewPage(endpoints, "Scripted")
+	assert.Contains(t, viewed, "<p>Hello</p>")
+	assert.NotContains(t, viewed, "script")
+}
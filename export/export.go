@@ -0,0 +1,314 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/render"
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+// assetDirs are copied from the doc root as they are when present.
+var assetDirs = []string{"assets", "attachments"}
+
+var (
+	viewHrefRegex = regexp.MustCompile(`href="/view/([a-zA-Z0-9]+)(#[^"]*)?"`)
+	// The edit links of the view template and headings mean nothing in a
+	// static copy, so they are dropped along with their text.
+	editAnchorRegex = regexp.MustCompile(
+		`(?s)<a\s+href="/edit/[^"]*"\s*>\s*edit\s*</a>`)
+	// Other anchors into the running wiki (history, save, ...) are reduced
+	// to their text.
+	dynamicAnchorRegex = regexp.MustCompile(
+		`(?s)<a\s[^>]*href="/[^"]*"[^>]*>(.*?)</a>`)
+	// Assets and attachments are copied, so they are linked relatively.
+	assetURLRegex = regexp.MustCompile(
+		`\b(href|src)="/((?:assets|attachments)/[^"]*)"`)
+	wikiLinkRegex = regexp.MustCompile(
+		`\[\[([a-zA-Z0-9]+)(#[^\]|]*)?(?:\|([^\]]*))?\]\]`)
+	// Tag pages are not exported, so tags keep only their name.
+	tagLinkRegex   = regexp.MustCompile(`\[\[Tag:([a-zA-Z0-9_-]+)\]\]`)
+	tagMarkupRegex = regexp.MustCompile(`\[\[Tag:[^\]]*\]\]`)
+	markupRegex    = regexp.MustCompile(`<[^>]*>|\[\[|\]\]`)
+	spaceRegex     = regexp.MustCompile(`\s+`)
+)
+
+type Renderer interface {
+	Render(tmpl string, data interface{}) ([]byte, error)
+}
+
+// Target receives the files of the exported tree.
+type Target interface {
+	WriteFile(name string, content []byte) error
+}
+
+type Directory string
+
+func (self Directory) WriteFile(name string, content []byte) error {
+	path := filepath.Join(string(self), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+type Zip struct {
+	Writer *zip.Writer
+}
+
+func (self Zip) WriteFile(name string, content []byte) error {
+	file, err := self.Writer.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	return err
+}
+
+type Options struct {
+	// Prefix limits the export to titles starting with it.
+	Prefix string
+	// BaseURL makes sitemap locations absolute. Without it they are
+	// relative to the export root.
+	BaseURL string
+	DocRoot string
+	Render  render.Options
+}
+
+type SearchEntry struct {
+	Title string   `json:"title"`
+	URL   string   `json:"url"`
+	Tags  []string `json:"tags"`
+	Text  string   `json:"text"`
+}
+
+type Report struct {
+	Pages  int
+	Assets int
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// RewriteLinks makes a rendered page work as a file next to the other
+// exported pages. Links to exported pages, assets and attachments become
+// relative paths, links to other pages and tags become plain text, edit
+// links are dropped and other links into the running wiki keep only their
+// text.
+func RewriteLinks(rendered []byte, exported map[string]bool) []byte {
+	rendered = tagLinkRegex.ReplaceAll(rendered, []byte("$1"))
+	rendered = viewHrefRegex.ReplaceAllFunc(rendered, func(match []byte) []byte {
+		parts := viewHrefRegex.FindSubmatch(match)
+		if !exported[string(parts[1])] {
+			return []byte(`href="#"`)
+		}
+		return []byte(`href="` + string(parts[1]) + ".html" +
+			string(parts[2]) + `"`)
+	})
+	rendered = editAnchorRegex.ReplaceAll(rendered, nil)
+	rendered = assetURLRegex.ReplaceAll(rendered, []byte(`$1="$2"`))
+	rendered = dynamicAnchorRegex.ReplaceAll(rendered, []byte("$1"))
+	return wikiLinkRegex.ReplaceAllFunc(rendered, func(match []byte) []byte {
+		parts := wikiLinkRegex.FindSubmatch(match)
+		title, section, label := string(parts[1]), string(parts[2]),
+			string(parts[3])
+		if label == "" {
+			label = title
+		}
+		if !exported[title] {
+			return []byte(label)
+		}
+		if section != "" {
+			section = "#" + render.Slug(section[1:])
+		}
+		return []byte(`<a href="` + title + ".html" + section + `">` +
+			label + "</a>")
+	})
+}
+
+func document(title string, body []byte, stylesheet bool) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("<!DOCTYPE html>\n<html>\n<head>\n" +
+		"<meta charset=\"utf-8\">\n<title>" + html.EscapeString(title) +
+		"</title>\n")
+	if stylesheet {
+		buffer.WriteString("<link rel=\"stylesheet\" href=\"assets/wiki.css\">\n")
+	}
+	buffer.WriteString("</head>\n<body>\n")
+	buffer.Write(body)
+	buffer.WriteString("\n</body>\n</html>\n")
+	return buffer.Bytes()
+}
+
+func plainText(body []byte) string {
+	text := tagMarkupRegex.ReplaceAll(body, nil)
+	text = bytes.ReplaceAll(text, []byte(render.TOCMarker), nil)
+	text = wikiLinkRegex.ReplaceAllFunc(text, func(match []byte) []byte {
+		parts := wikiLinkRegex.FindSubmatch(match)
+		if len(parts[3]) > 0 {
+			return parts[3]
+		}
+		return parts[1]
+	})
+	text = markupRegex.ReplaceAll(text, []byte(" "))
+	return strings.TrimSpace(spaceRegex.ReplaceAllString(string(text), " "))
+}
+
+func copyAssets(docRoot string, target Target) (int, error) {
+	copied := 0
+	for _, dir := range assetDirs {
+		root := filepath.Join(docRoot, dir)
+		if !util.Exists(root) {
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry,
+			err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			relative, err := filepath.Rel(docRoot, path)
+			if err != nil {
+				return err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			copied++
+			return target.WriteFile(filepath.ToSlash(relative), content)
+		})
+		if err != nil {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
+
+// Export renders the pages of store through the view template into target,
+// together with an index page, sitemap.xml, search-index.json and the
+// doc root's assets and attachments.
+func Export(
+	store storage.Storage,
+	renderer Renderer,
+	target Target,
+	options Options) (Report, error) {
+	report := Report{}
+	titles, err := store.Titles()
+	if err != nil {
+		return report, err
+	}
+	exported := map[string]bool{}
+	selected := []string{}
+	for _, title := range titles {
+		if strings.HasPrefix(title, options.Prefix) {
+			exported[title] = true
+			selected = append(selected, title)
+		}
+	}
+	sort.Strings(selected)
+	stylesheet := options.DocRoot != "" &&
+		util.Exists(filepath.Join(options.DocRoot, "assets", "wiki.css"))
+
+	index := sitemap{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	search := []SearchEntry{}
+	var list bytes.Buffer
+	list.WriteString("<h1>Pages</h1>\n<ul>\n")
+	base := strings.TrimRight(options.BaseURL, "/")
+	if base != "" {
+		base += "/"
+	}
+	for _, title := range selected {
+		page, err := store.Load(title)
+		if err != nil {
+			return report, err
+		}
+		// Wiki links are left to RewriteLinks, which knows what is exported.
+		body, _ := render.Transclude(title,
+			render.Sections(page.Body, options.Render), store.Load)
+		body = render.Sanitize(body)
+		rendered, err := renderer.Render("view", &types.Page{
+			Title: page.Title, Body: body, Meta: page.Meta})
+		if err != nil {
+			return report, err
+		}
+		name := title + ".html"
+		content := document(title, RewriteLinks(rendered, exported),
+			stylesheet)
+		if err = target.WriteFile(name, content); err != nil {
+			return report, err
+		}
+		report.Pages++
+
+		location := sitemapURL{Loc: base + name}
+		if history, err := store.History(title); err == nil &&
+			len(history) > 0 {
+			location.LastMod = history[len(history)-1].Timestamp.UTC().
+				Format(time.RFC3339)
+		}
+		index.URLs = append(index.URLs, location)
+		search = append(search, SearchEntry{Title: title, URL: name,
+			Tags: util.PageTags(page), Text: plainText(page.Body)})
+		list.WriteString("<li><a href=\"" + name + "\">" + title +
+			"</a></li>\n")
+	}
+	list.WriteString("</ul>")
+
+	if err = target.WriteFile("index.html",
+		document("Pages", list.Bytes(), stylesheet)); err != nil {
+		return report, err
+	}
+	content, err := xml.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return report, err
+	}
+	content = append([]byte(xml.Header), content...)
+	if err = target.WriteFile("sitemap.xml", content); err != nil {
+		return report, err
+	}
+	if content, err = json.Marshal(search); err != nil {
+		return report, err
+	}
+	if err = target.WriteFile("search-index.json", content); err != nil {
+		return report, err
+	}
+	if options.DocRoot != "" {
+		report.Assets, err = copyAssets(options.DocRoot, target)
+	}
+	return report, err
+}
+
+// ExportZip writes the export as a zip archive to writer.
+func ExportZip(
+	store storage.Storage,
+	renderer Renderer,
+	writer io.Writer,
+	options Options) (Report, error) {
+	archive := zip.NewWriter(writer)
+	report, err := Export(store, renderer, Zip{Writer: archive}, options)
+	if err != nil {
+		archive.Close()
+		return report, err
+	}
+	return report, archive.Close()
+}
@@ -0,0 +1,104 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+type fakeRenderer struct{}
+
+func (self fakeRenderer) Render(tmpl string, data interface{}) ([]byte, error) {
+	page := data.(*types.Page)
+	return []byte(`<h1>` + page.Title + `</h1><a href="/edit/` + page.Title +
+		`">edit</a><div>` + string(page.Body) + `</div>`), nil
+}
+
+func TestRewriteLinks(t *testing.T) {
+	exported := map[string]bool{"DocsB": true}
+	rendered := []byte(`<a href="/edit/DocsA">
+		edit</a><a href="/view/DocsB#Setup">B</a><a href="/view/Private">P</a>` +
+		`[[DocsB|see B]] [[Private]] [[DocsB#Setup]]`)
+	assert.Equal(t, `<a href="DocsB.html#Setup">B</a><a href="#">P</a>`+
+		`<a href="DocsB.html">see B</a> Private `+
+		`<a href="DocsB.html#setup">DocsB</a>`,
+		string(RewriteLinks(rendered, exported)))
+
+	rendered = []byte(`<a href="/attachments/a.pdf">the manual</a> ` +
+		`<img src="/assets/logo.png" alt="logo"> ` +
+		`<a class="x" href="/history/DocsB">older versions</a> [[Tag:Guide]]`)
+	assert.Equal(t, `<a href="attachments/a.pdf">the manual</a> `+
+		`<img src="assets/logo.png" alt="logo"> older versions Guide`,
+		string(RewriteLinks(rendered, exported)))
+}
+
+func TestExportToDirectory(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewFilesystem(root)
+	for title, body := range map[string]string{
+		"DocsA":   "Read [[DocsB]] not [[Private]]. [[Tag:guide]]",
+		"DocsB":   "Back to [[DocsA|the start]].",
+		"Private": "Secret."} {
+		page := &types.Page{Title: title, Body: []byte(body)}
+		assert.NoError(t, store.Save(page, &types.Revision{}))
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "attachments"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "attachments", "a.png"),
+		[]byte("png"), 0600))
+
+	out := t.TempDir()
+	report, err := Export(store, fakeRenderer{}, Directory(out),
+		Options{Prefix: "Docs", BaseURL: "https://example.com/", DocRoot: root})
+	assert.NoError(t, err)
+	assert.Equal(t, Report{Pages: 2, Assets: 1}, report)
+
+	page, err := os.ReadFile(filepath.Join(out, "DocsA.html"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(page), `<title>DocsA</title>`)
+	assert.Contains(t, string(page), `Read <a href="DocsB.html">DocsB</a> not Private.`)
+	assert.NotContains(t, string(page), "/edit/")
+	assert.NoFileExists(t, filepath.Join(out, "Private.html"))
+	assert.FileExists(t, filepath.Join(out, "attachments", "a.png"))
+
+	sitemap, err := os.ReadFile(filepath.Join(out, "sitemap.xml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(sitemap), "<loc>https://example.com/DocsA.html</loc>")
+
+	content, err := os.ReadFile(filepath.Join(out, "search-index.json"))
+	assert.NoError(t, err)
+	search := []SearchEntry{}
+	assert.NoError(t, json.Unmarshal(content, &search))
+	assert.Equal(t, []SearchEntry{
+		{Title: "DocsA", URL: "DocsA.html", Tags: []string{"guide"},
+			Text: "Read DocsB not Private."},
+		{Title: "DocsB", URL: "DocsB.html", Tags: []string{},
+			Text: "Back to the start."}}, search)
+}
+
+func TestExportZip(t *testing.T) {
+	store := storage.NewFilesystem(t.TempDir())
+	page := &types.Page{Title: "Home", Body: []byte("Hi.")}
+	assert.NoError(t, store.Save(page, &types.Revision{}))
+
+	var buffer bytes.Buffer
+	_, err := ExportZip(store, fakeRenderer{}, &buffer, Options{})
+	assert.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()),
+		int64(buffer.Len()))
+	assert.NoError(t, err)
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, "Home.html index.html sitemap.xml search-index.json",
+		strings.Join(names, " "))
+}
@@ -0,0 +1,168 @@
+package feeds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+type Entry struct {
+	Revision types.Revision
+	Diff     string
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Summary string      `xml:"summary,omitempty"`
+	Content atomContent `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// EntryID is stable for the life of a revision so feed readers never see
+// the same edit twice.
+func EntryID(revision types.Revision) string {
+	return fmt.Sprintf("urn:wiki:revision:%s:%d", revision.Title,
+		revision.Number)
+}
+
+func entryTitle(revision types.Revision) string {
+	title := fmt.Sprintf("%s r%d", revision.Title, revision.Number)
+	if revision.Minor {
+		title += " (minor)"
+	}
+	return title
+}
+
+func entryLink(baseURL string, revision types.Revision) string {
+	return baseURL + "/view/" + revision.Title
+}
+
+func entryContent(entry Entry) string {
+	return "<pre>" + html.EscapeString(entry.Diff) + "</pre>"
+}
+
+func Updated(entries []Entry) time.Time {
+	updated := time.Time{}
+	for _, entry := range entries {
+		if entry.Revision.Timestamp.After(updated) {
+			updated = entry.Revision.Timestamp
+		}
+	}
+	return updated
+}
+
+func ETag(entries []Entry) string {
+	hash := sha256.New()
+	for _, entry := range entries {
+		fmt.Fprintf(hash, "%s\n", EntryID(entry.Revision))
+	}
+	return "\"" + hex.EncodeToString(hash.Sum(nil)[:16]) + "\""
+}
+
+func Atom(
+	title string,
+	id string,
+	baseURL string,
+	selfURL string,
+	entries []Entry) ([]byte, error) {
+	feed := atomFeed{
+		Title: title,
+		ID:    id,
+		Links: []atomLink{
+			{Href: baseURL + "/recent"},
+			{Href: selfURL, Rel: "self"}},
+		Updated: Updated(entries).UTC().Format(time.RFC3339),
+		Author:  "wiki",
+		Entries: []atomEntry{}}
+	for _, entry := range entries {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   entryTitle(entry.Revision),
+			ID:      EntryID(entry.Revision),
+			Link:    atomLink{Href: entryLink(baseURL, entry.Revision)},
+			Updated: entry.Revision.Timestamp.UTC().Format(time.RFC3339),
+			Summary: entry.Revision.Summary,
+			Content: atomContent{Type: "html", Body: entryContent(entry)}})
+	}
+	return marshal(feed)
+}
+
+func RSS(
+	title string,
+	baseURL string,
+	description string,
+	entries []Entry) ([]byte, error) {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        baseURL + "/recent",
+			Description: description,
+			Items:       []rssItem{}}}
+	for _, entry := range entries {
+		description := html.EscapeString(entry.Revision.Summary) +
+			entryContent(entry)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       entryTitle(entry.Revision),
+			Link:        entryLink(baseURL, entry.Revision),
+			GUID:        EntryID(entry.Revision),
+			PubDate:     entry.Revision.Timestamp.UTC().Format(time.RFC1123Z),
+			Description: description})
+	}
+	return marshal(feed)
+}
+
+func marshal(feed interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,61 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleEntries() []Entry {
+	timestamp := time.Date(2022, 11, 5, 12, 0, 0, 0, time.UTC)
+	return []Entry{
+		{Revision: types.Revision{Title: "ABC", Number: 2, Summary: "Typo",
+			Minor: true, Timestamp: timestamp.Add(time.Hour)},
+			Diff: "-teh\n+the\n"},
+		{Revision: types.Revision{Title: "ABC", Number: 1, Summary: "Create",
+			Timestamp: timestamp},
+			Diff: "+teh\n"}}
+}
+
+func TestAtom(t *testing.T) {
+	body, err := Atom("Recent changes", "urn:wiki:feed:recent",
+		"http://wiki", "http://wiki/feeds/recent.atom", sampleEntries())
+	if err != nil {
+		t.Fatalf("Failed to build atom feed with %s.", err)
+	}
+	var feed atomFeed
+	if err = xml.Unmarshal(body, &feed); err != nil {
+		t.Fatalf("Failed to parse atom feed with %s.", err)
+	}
+	assert.Equal(t, "2022-11-05T13:00:00Z", feed.Updated)
+	assert.Equal(t, 2, len(feed.Entries))
+	assert.Equal(t, "urn:wiki:revision:ABC:2", feed.Entries[0].ID)
+	assert.Equal(t, "ABC r2 (minor)", feed.Entries[0].Title)
+	assert.Equal(t, "http://wiki/view/ABC", feed.Entries[0].Link.Href)
+	assert.Equal(t, "<pre>-teh\n+the\n</pre>", feed.Entries[0].Content.Body)
+}
+
+func TestRSS(t *testing.T) {
+	body, err := RSS("Recent changes", "http://wiki", "Changes",
+		sampleEntries())
+	if err != nil {
+		t.Fatalf("Failed to build rss feed with %s.", err)
+	}
+	var feed rssFeed
+	if err = xml.Unmarshal(body, &feed); err != nil {
+		t.Fatalf("Failed to parse rss feed with %s.", err)
+	}
+	assert.Equal(t, "2.0", feed.Version)
+	assert.Equal(t, 2, len(feed.Channel.Items))
+	assert.Equal(t, "urn:wiki:revision:ABC:1", feed.Channel.Items[1].GUID)
+	assert.Equal(t, "Sat, 05 Nov 2022 12:00:00 +0000",
+		feed.Channel.Items[1].PubDate)
+}
+
+func TestETagIsStable(t *testing.T) {
+	assert.Equal(t, ETag(sampleEntries()), ETag(sampleEntries()))
+	assert.NotEqual(t, ETag(sampleEntries()), ETag(sampleEntries()[1:]))
+}
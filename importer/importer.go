@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+var titleRegex = regexp.MustCompile("^[a-zA-Z0-9]+$")
+
+// Revision is one version of an imported page, oldest first.
+type Revision struct {
+	Revision types.Revision
+	Source   []byte
+}
+
+// Document is a page as named by the system it comes from.
+type Document struct {
+	Name      string
+	Revisions []Revision
+}
+
+type Planned struct {
+	Name      string
+	Title     string
+	Revisions int
+}
+
+type Problem struct {
+	Name   string
+	Title  string
+	Reason string
+}
+
+// Report says what an import would do, or did.
+type Report struct {
+	Imported  []Planned
+	Conflicts []Problem
+	Invalid   []Problem
+}
+
+// Title maps a foreign page name to a wiki title by joining its words in
+// CamelCase: "Main Page" and "main_page" both become "MainPage" and
+// "ops/run-book" becomes "OpsRunBook". Anything but ASCII letters and
+// digits separates words. It returns "" when nothing usable is left.
+func Title(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) ||
+			unicode.IsDigit(r))
+	})
+	var title strings.Builder
+	for _, word := range words {
+		title.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	if !titleRegex.MatchString(title.String()) {
+		return ""
+	}
+	return title.String()
+}
+
+// Plan maps every document to a title and sorts out the ones that cannot
+// be imported: names with no valid title, titles store already has, and
+// names that collide with an earlier document.
+func Plan(store storage.Storage, documents []Document) (Report, error) {
+	report := Report{
+		Imported:  []Planned{},
+		Conflicts: []Problem{},
+		Invalid:   []Problem{}}
+	claimed := map[string]string{}
+	for _, document := range documents {
+		title := Title(document.Name)
+		switch {
+		case title == "":
+			report.Invalid = append(report.Invalid, Problem{
+				Name: document.Name, Reason: "no valid title"})
+			continue
+		case len(document.Revisions) == 0:
+			report.Invalid = append(report.Invalid, Problem{
+				Name: document.Name, Title: title, Reason: "no revisions"})
+			continue
+		case claimed[title] != "":
+			report.Conflicts = append(report.Conflicts, Problem{
+				Name: document.Name, Title: title,
+				Reason: "same title as " + claimed[title]})
+			continue
+		}
+		_, err := store.Load(title)
+		if err == nil {
+			report.Conflicts = append(report.Conflicts, Problem{
+				Name: document.Name, Title: title,
+				Reason: "page already exists"})
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return report, err
+		}
+		claimed[title] = document.Name
+		report.Imported = append(report.Imported, Planned{
+			Name: document.Name, Title: title,
+			Revisions: len(document.Revisions)})
+	}
+	return report, nil
+}
+
+// Import saves the documents Plan accepts, replaying their revisions in
+// order, and leaves the rest alone. With dryRun nothing is written.
+// Otherwise saved, when not nil, is called after each page is written,
+// including one an error stopped part way, with the revisions it got.
+func Import(
+	store storage.Storage,
+	documents []Document,
+	dryRun bool,
+	saved func(Planned) error) (Report, error) {
+	report, err := Plan(store, documents)
+	if err != nil || dryRun {
+		return report, err
+	}
+	titles := map[string]string{}
+	for _, planned := range report.Imported {
+		titles[planned.Name] = planned.Title
+	}
+	for _, document := range documents {
+		title, ok := titles[document.Name]
+		if !ok {
+			continue
+		}
+		revisions := append([]Revision{}, document.Revisions...)
+		sort.SliceStable(revisions, func(i, j int) bool {
+			return revisions[i].Revision.Timestamp.Before(
+				revisions[j].Revision.Timestamp)
+		})
+		written := 0
+		for _, imported := range revisions {
+			meta, body, err := util.ParseFrontMatter(imported.Source)
+			if err != nil {
+				meta, body = nil, imported.Source
+			}
+			page := &types.Page{Title: title, Body: body, Meta: meta}
+			revision := imported.Revision
+			if err = store.Save(page, &revision); err != nil {
+				err = fmt.Errorf("%s: %w", document.Name, err)
+				if written > 0 && saved != nil {
+					err = errors.Join(err, saved(Planned{Name: document.Name,
+						Title: title, Revisions: written}))
+				}
+				return report, err
+			}
+			written++
+		}
+		if saved != nil {
+			err = saved(Planned{Name: document.Name, Title: title,
+				Revisions: written})
+			if err != nil {
+				return report, fmt.Errorf("%s: %w", document.Name, err)
+			}
+		}
+		// A later document with the same name was planned as a conflict.
+		delete(titles, document.Name)
+	}
+	return report, nil
+}
+
+func (self Report) Write(writer io.Writer, dryRun bool) {
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+	for _, planned := range self.Imported {
+		fmt.Fprintf(writer, "%s %q as %s (%d revisions)\n", verb,
+			planned.Name, planned.Title, planned.Revisions)
+	}
+	for _, problem := range self.Conflicts {
+		fmt.Fprintf(writer, "Conflict: %q as %s: %s\n", problem.Name,
+			problem.Title, problem.Reason)
+	}
+	for _, problem := range self.Invalid {
+		fmt.Fprintf(writer, "Invalid: %q: %s\n", problem.Name, problem.Reason)
+	}
+	fmt.Fprintf(writer, "%d to import, %d conflicts, %d invalid.\n",
+		len(self.Imported), len(self.Conflicts), len(self.Invalid))
+}
@@ -0,0 +1,178 @@
+package importer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/storage"
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+const dump = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/">
+  <siteinfo><sitename>Old</sitename></siteinfo>
+  <page>
+    <title>Main Page</title>
+    <ns>0</ns>
+    <revision>
+      <timestamp>2020-01-02T03:04:05Z</timestamp>
+      <contributor><username>Alice</username></contributor>
+      <comment>first</comment>
+      <text xml:space="preserve">Hello &amp; welcome.</text>
+    </revision>
+    <revision>
+      <timestamp>2020-02-02T03:04:05Z</timestamp>
+      <contributor><ip>10.0.0.1</ip></contributor>
+      <minor />
+      <text xml:space="preserve">Hello again.</text>
+    </revision>
+  </page>
+  <page>
+    <title>Talk:Main Page</title>
+    <ns>1</ns>
+    <revision><timestamp>2020-01-02T03:04:05Z</timestamp><text>x</text></revision>
+  </page>
+  <page>
+    <title>main_page</title>
+    <ns>0</ns>
+    <revision><timestamp>2020-01-02T03:04:05Z</timestamp><text>dup</text></revision>
+  </page>
+  <page>
+    <title>???</title>
+    <ns>0</ns>
+    <revision><timestamp>2020-01-02T03:04:05Z</timestamp><text>bad</text></revision>
+  </page>
+</mediawiki>`
+
+func TestTitle(t *testing.T) {
+	assert.Equal(t, "MainPage", Title("Main Page"))
+	assert.Equal(t, "MainPage", Title("main_page"))
+	assert.Equal(t, "OpsRunBook2", Title("ops/run-book 2"))
+	assert.Equal(t, "", Title("!!!"))
+}
+
+func TestImportMediaWiki(t *testing.T) {
+	documents, err := ReadMediaWiki(strings.NewReader(dump))
+	assert.NoError(t, err)
+	assert.Len(t, documents, 3)
+
+	store := storage.NewFilesystem(t.TempDir())
+	report, err := Import(store, documents, true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Planned{{Name: "Main Page", Title: "MainPage",
+		Revisions: 2}}, report.Imported)
+	assert.Equal(t, []Problem{{Name: "main_page", Title: "MainPage",
+		Reason: "same title as Main Page"}}, report.Conflicts)
+	assert.Equal(t, []Problem{{Name: "???", Reason: "no valid title"}},
+		report.Invalid)
+	// A dry run writes nothing.
+	titles, _ := store.Titles()
+	assert.Empty(t, titles)
+
+	_, err = Import(store, documents, false, nil)
+	assert.NoError(t, err)
+	history, err := store.History("MainPage")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "Alice", history[0].Author)
+	assert.Equal(t, "first", history[0].Summary)
+	assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		history[0].Timestamp)
+	assert.Equal(t, "10.0.0.1", history[1].Author)
+	assert.True(t, history[1].Minor)
+	first, _ := store.Revision("MainPage", 1)
+	assert.Equal(t, "Hello & welcome.\n", string(first.Body))
+	assert.Equal(t, "mediawiki", first.Meta["format"])
+
+	// Importing again only reports conflicts.
+	report, err = Import(store, documents, false, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Imported)
+	assert.Equal(t, "page already exists", report.Conflicts[0].Reason)
+}
+
+func TestImportMarkdown(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "ops"), 0700))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, ".git"), 0700))
+	files := map[string]string{
+		"ops/run-book.md": "---\nowner: ops\n---\n# Runbook\n",
+		"README.md":       "# Notes\n",
+		"ignored.txt":     "not markdown",
+		".git/x.md":       "hidden"}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(root, name),
+			[]byte(content), 0600))
+	}
+
+	documents, err := ReadMarkdown(root)
+	assert.NoError(t, err)
+	assert.Len(t, documents, 2)
+
+	store := storage.NewFilesystem(t.TempDir())
+	report, err := Import(store, documents, false, nil)
+	assert.NoError(t, err)
+	assert.Len(t, report.Imported, 2)
+	page, err := store.Load("OpsRunBook")
+	assert.NoError(t, err)
+	assert.Equal(t, "# Runbook\n", string(page.Body))
+	assert.Equal(t, map[string]interface{}{"owner": "ops",
+		"format": "markdown"}, page.Meta)
+	history, _ := store.History("Readme")
+	assert.Empty(t, history)
+	history, _ = store.History("README")
+	assert.Len(t, history, 1)
+	assert.Equal(t, "Imported from README.md", history[0].Summary)
+}
+
+// failingStore fails every save after the first saves.
+type failingStore struct {
+	storage.Storage
+	saves int
+}
+
+func (self *failingStore) Save(
+	page *types.Page,
+	revision *types.Revision) error {
+	if self.saves == 0 {
+		return errors.New("disk full")
+	}
+	self.saves--
+	return self.Storage.Save(page, revision)
+}
+
+func TestImportReportsEachSavedPage(t *testing.T) {
+	documents, err := ReadMediaWiki(strings.NewReader(dump))
+	assert.NoError(t, err)
+	documents = append(documents, Document{Name: "Later",
+		Revisions: []Revision{{Source: []byte("later")}}})
+
+	// The first page gets one of its two revisions before saves fail.
+	store := &failingStore{
+		Storage: storage.NewFilesystem(t.TempDir()), saves: 1}
+	saved := []Planned{}
+	_, err = Import(store, documents, false, func(planned Planned) error {
+		saved = append(saved, planned)
+		return nil
+	})
+	assert.ErrorContains(t, err, "disk full")
+	assert.Equal(t, []Planned{{Name: "Main Page", Title: "MainPage",
+		Revisions: 1}}, saved)
+
+	store = &failingStore{
+		Storage: storage.NewFilesystem(t.TempDir()), saves: 10}
+	saved = []Planned{}
+	_, err = Import(store, documents, false, func(planned Planned) error {
+		saved = append(saved, planned)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Planned{
+		{Name: "Main Page", Title: "MainPage", Revisions: 2},
+		{Name: "Later", Title: "Later", Revisions: 1}}, saved)
+}
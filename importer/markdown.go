@@ -0,0 +1,78 @@
+package importer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+// ReadMarkdown collects the .md files under root. A file's path relative to
+// root, without the extension, is its name, so ops/run-book.md is named
+// ops/run-book. Each file becomes a single revision dated by its
+// modification time, and its front matter gains format: markdown unless it
+// names a format already.
+func ReadMarkdown(root string) ([]Document, error) {
+	documents := []Document{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry,
+		err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		source, err := markdownSource(content)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(relative),
+			filepath.Ext(relative))
+		documents = append(documents, Document{
+			Name: name,
+			Revisions: []Revision{{
+				Revision: types.Revision{
+					Summary:   "Imported from " + filepath.ToSlash(relative),
+					Author:    "import",
+					Timestamp: info.ModTime().UTC()},
+				Source: source}}})
+		return nil
+	})
+	return documents, err
+}
+
+func markdownSource(content []byte) ([]byte, error) {
+	meta, body, err := util.ParseFrontMatter(content)
+	if err != nil {
+		// Not front matter after all; keep the file as it is.
+		meta, body = nil, content
+	}
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	if _, ok := meta["format"]; !ok {
+		meta["format"] = "markdown"
+	}
+	return util.Source(&types.Page{Body: body, Meta: meta})
+}
@@ -0,0 +1,79 @@
+package importer
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+type mediaWikiRevision struct {
+	Timestamp   string `xml:"timestamp"`
+	Contributor struct {
+		Username string `xml:"username"`
+		IP       string `xml:"ip"`
+	} `xml:"contributor"`
+	Comment string    `xml:"comment"`
+	Minor   *struct{} `xml:"minor"`
+	Text    string    `xml:"text"`
+}
+
+type mediaWikiPage struct {
+	Title     string              `xml:"title"`
+	Namespace int                 `xml:"ns"`
+	Redirect  *struct{}           `xml:"redirect"`
+	Revisions []mediaWikiRevision `xml:"revision"`
+}
+
+// ReadMediaWiki reads the pages of a MediaWiki XML export. Pages are
+// decoded one at a time, but all of them are returned together, since
+// Plan has to see every name before it can spot collisions, so the text of
+// the whole dump must fit in memory. Only main namespace pages are
+// returned; talk, user and other namespaces and redirects are
+// left out. Bodies are kept in wikitext, marked with format: mediawiki.
+func ReadMediaWiki(reader io.Reader) ([]Document, error) {
+	decoder := xml.NewDecoder(reader)
+	documents := []Document{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return documents, nil
+		} else if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "page" {
+			continue
+		}
+		var page mediaWikiPage
+		if err = decoder.DecodeElement(&page, &start); err != nil {
+			return nil, err
+		}
+		if page.Namespace != 0 || page.Redirect != nil {
+			continue
+		}
+		document := Document{Name: page.Title, Revisions: []Revision{}}
+		for _, revision := range page.Revisions {
+			timestamp, err := time.Parse(time.RFC3339, revision.Timestamp)
+			if err != nil {
+				return nil, err
+			}
+			author := revision.Contributor.Username
+			if author == "" {
+				author = revision.Contributor.IP
+			}
+			source := "---\nformat: mediawiki\n---\n" +
+				strings.TrimRight(revision.Text, "\n") + "\n"
+			document.Revisions = append(document.Revisions, Revision{
+				Revision: types.Revision{
+					Summary:   revision.Comment,
+					Minor:     revision.Minor != nil,
+					Author:    author,
+					Timestamp: timestamp.UTC()},
+				Source: []byte(source)})
+		}
+		documents = append(documents, document)
+	}
+}
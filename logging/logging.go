@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey struct{}
+
+// New builds a logger from the log section of the config. Level is one of
+// debug, info, warn or error and defaults to info; Format is text or json
+// and defaults to text.
+func New(config types.Log, out io.Writer) (*slog.Logger, error) {
+	level := slog.LevelInfo
+	if config.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", config.Level)
+		}
+	}
+	options := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(config.Format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(out, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", config.Format)
+	}
+}
+
+// FromContext returns the logger RequestID stored for the request, or the
+// default logger outside of one.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// RequestID reuses the caller's X-Request-ID or makes one, echoes it on the
+// response and puts a logger tagged with it in the request context.
+func RequestID(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(
+		writter http.ResponseWriter,
+		request *http.Request) {
+		id := request.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		writter.Header().Set(RequestIDHeader, id)
+		tagged := logger.With("request_id", id)
+		next.ServeHTTP(writter,
+			request.WithContext(WithLogger(request.Context(), tagged)))
+	})
+}
+
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (self *accessWriter) WriteHeader(status int) {
+	if self.status == 0 {
+		self.status = status
+	}
+	self.ResponseWriter.WriteHeader(status)
+}
+
+func (self *accessWriter) Write(data []byte) (int, error) {
+	if self.status == 0 {
+		self.status = http.StatusOK
+	}
+	count, err := self.ResponseWriter.Write(data)
+	self.bytes += count
+	return count, err
+}
+
+// AccessLog logs one record per request with the fields of the Common Log
+// Format, plus the latency. The record's own time stands in for the CLF
+// timestamp. It has to run inside RequestID to pick up the
+// request's logger.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(
+		writter http.ResponseWriter,
+		request *http.Request) {
+		start := time.Now()
+		recorder := &accessWriter{ResponseWriter: writter}
+		next.ServeHTTP(recorder, request)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		host, _, err := net.SplitHostPort(request.RemoteAddr)
+		if err != nil {
+			host = request.RemoteAddr
+		}
+		user := "-"
+		if name, _, ok := request.BasicAuth(); ok {
+			user = name
+		}
+		FromContext(request.Context()).Info("access",
+			"remote_host", host,
+			"user", user,
+			"request", request.Method+" "+request.URL.RequestURI()+" "+
+				request.Proto,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration", time.Since(start))
+	})
+}
@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+func TestNewHonoursLevelAndFormat(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := New(types.Log{Level: "warn", Format: "json"}, out)
+	assert.NoError(t, err)
+	logger.Info("dropped")
+	logger.Warn("kept", "title", "Home")
+	record := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	assert.Equal(t, "kept", record["msg"])
+	assert.Equal(t, "Home", record["title"])
+
+	_, err = New(types.Log{Level: "loud"}, out)
+	assert.Error(t, err)
+	_, err = New(types.Log{Format: "xml"}, out)
+	assert.Error(t, err)
+}
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, _ := New(types.Log{Format: "json"}, out)
+	handler := RequestID(logger, AccessLog(http.HandlerFunc(func(
+		writter http.ResponseWriter,
+		request *http.Request) {
+		FromContext(request.Context()).Info("inside")
+		writter.WriteHeader(http.StatusTeapot)
+		writter.Write([]byte("short and stout"))
+	})))
+
+	request := httptest.NewRequest(http.MethodGet, "/view/Home", nil)
+	request.Header.Set(RequestIDHeader, "abc123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, request)
+	assert.Equal(t, "abc123", rec.Header().Get(RequestIDHeader))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	inside := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &inside))
+	assert.Equal(t, "abc123", inside["request_id"])
+	access := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &access))
+	assert.Equal(t, "abc123", access["request_id"])
+	assert.Equal(t, "GET /view/Home HTTP/1.1", access["request"])
+	assert.Equal(t, 418.0, access["status"])
+	assert.Equal(t, 15.0, access["bytes"])
+
+	// Without a header one is generated.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Len(t, rec.Header().Get(RequestIDHeader), 16)
+}
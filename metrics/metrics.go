@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/cache"
+)
+
+// Metrics owns its own registry rather than the global one so that tests
+// and multiple servers in one process don't collide on registration.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	inFlight        *prometheus.GaugeVec
+	requestDuration *prometheus.HistogramVec
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+	auditFailures   prometheus.Counter
+}
+
+func New() *Metrics {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	self := &Metrics{
+		Registry: registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wiki_http_requests_total",
+			Help: "HTTP requests by handler and status code."},
+			[]string{"handler", "code"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "wiki_http_requests_in_flight",
+			Help: "Requests being served by handler. The wiki has no " +
+				"sessions, so this stands in for active users."},
+			[]string{"handler"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "wiki_http_request_duration_seconds",
+			Help:    "HTTP request latency by handler.",
+			Buckets: prometheus.DefBuckets},
+			[]string{"handler"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "wiki_storage_operation_duration_seconds",
+			Help:    "Storage operation latency by operation.",
+			Buckets: prometheus.DefBuckets},
+			[]string{"operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wiki_storage_errors_total",
+			Help: "Failed storage operations by operation."},
+			[]string{"operation"}),
+		auditFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "wiki_audit_failures_total",
+			Help: "Writes that were made but could not be audited."})}
+	registry.MustRegister(self.requests, self.inFlight, self.requestDuration,
+		self.storageDuration, self.storageErrors, self.auditFailures)
+	return self
+}
+
+// RegisterPageCount exports the number of pages, counted on each scrape.
+func (self *Metrics) RegisterPageCount(titles func() ([]string, error)) {
+	self.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "wiki_pages",
+		Help: "Number of pages in storage."},
+		func() float64 {
+			all, err := titles()
+			if err != nil {
+				return -1
+			}
+			return float64(len(all))
+		}))
+}
+
+func (self *Metrics) RegisterCache(lru *cache.LRU) {
+	counter := func(name, help string, value func(cache.Stats) uint64) {
+		self.Registry.MustRegister(prometheus.NewCounterFunc(
+			prometheus.CounterOpts{Name: name, Help: help},
+			func() float64 { return float64(value(lru.Stats())) }))
+	}
+	gauge := func(name, help string, value func(cache.Stats) int) {
+		self.Registry.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: name, Help: help},
+			func() float64 { return float64(value(lru.Stats())) }))
+	}
+	counter("wiki_cache_hits_total", "Rendered-page cache hits.",
+		func(stats cache.Stats) uint64 { return stats.Hits })
+	counter("wiki_cache_misses_total", "Rendered-page cache misses.",
+		func(stats cache.Stats) uint64 { return stats.Misses })
+	counter("wiki_cache_evictions_total", "Rendered-page cache evictions.",
+		func(stats cache.Stats) uint64 { return stats.Evictions })
+	gauge("wiki_cache_entries", "Pages in the rendered-page cache.",
+		func(stats cache.Stats) int { return stats.Entries })
+	gauge("wiki_cache_capacity", "Capacity of the rendered-page cache.",
+		func(stats cache.Stats) int { return stats.Capacity })
+}
+
+// ObserveStorage records one storage call that started at start.
+func (self *Metrics) ObserveStorage(operation string, start time.Time,
+	err error) {
+	self.storageDuration.WithLabelValues(operation).Observe(
+		time.Since(start).Seconds())
+	if err != nil {
+		self.storageErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveAuditFailure counts a write that went through without its audit
+// entry; anything above zero wants an alert.
+func (self *Metrics) ObserveAuditFailure() {
+	self.auditFailures.Inc()
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (self *statusWriter) WriteHeader(status int) {
+	if self.status == 0 {
+		self.status = status
+	}
+	self.ResponseWriter.WriteHeader(status)
+}
+
+func (self *statusWriter) Write(data []byte) (int, error) {
+	if self.status == 0 {
+		self.status = http.StatusOK
+	}
+	return self.ResponseWriter.Write(data)
+}
+
+// Instrument counts and times every request to next under the handler
+// label, and tracks how many are in progress.
+func (self *Metrics) Instrument(
+	handler string,
+	next http.HandlerFunc) http.HandlerFunc {
+	return func(writter http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		inFlight := self.inFlight.WithLabelValues(handler)
+		inFlight.Inc()
+		defer inFlight.Dec()
+		recorder := &statusWriter{ResponseWriter: writter}
+		next(recorder, request)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		self.requestDuration.WithLabelValues(handler).Observe(
+			time.Since(start).Seconds())
+		self.requests.WithLabelValues(handler,
+			strconv.Itoa(recorder.status)).Inc()
+	}
+}
+
+func (self *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(self.Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/cache"
+)
+
+func TestInstrumentCountsByHandlerAndCode(t *testing.T) {
+	metrics := New()
+	handler := metrics.Instrument("view",
+		func(writter http.ResponseWriter, request *http.Request) {
+			if request.URL.Path == "/view/Missing" {
+				http.NotFound(writter, request)
+				return
+			}
+			writter.Write([]byte("ok"))
+		})
+	for _, path := range []string{"/view/A", "/view/B", "/view/Missing"} {
+		handler(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(t, 2.0, testutil.ToFloat64(
+		metrics.requests.WithLabelValues("view", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(
+		metrics.requests.WithLabelValues("view", "404")))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.requestDuration))
+}
+
+func TestInstrumentTracksInFlight(t *testing.T) {
+	metrics := New()
+	during := 0.0
+	handler := metrics.Instrument("save",
+		func(writter http.ResponseWriter, request *http.Request) {
+			during = testutil.ToFloat64(metrics.inFlight.WithLabelValues("save"))
+		})
+	handler(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/save/A", nil))
+	assert.Equal(t, 1.0, during)
+	assert.Equal(t, 0.0, testutil.ToFloat64(
+		metrics.inFlight.WithLabelValues("save")))
+}
+
+func TestObserveStorageCountsErrors(t *testing.T) {
+	metrics := New()
+	metrics.ObserveStorage("load", time.Now(), nil)
+	metrics.ObserveStorage("load", time.Now(), errors.New("boom"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(
+		metrics.storageErrors.WithLabelValues("load")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(
+		metrics.storageErrors.WithLabelValues("save")))
+
+	metrics.ObserveAuditFailure()
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.auditFailures))
+}
+
+func TestPageCountAndCache(t *testing.T) {
+	metrics := New()
+	metrics.RegisterPageCount(func() ([]string, error) {
+		return []string{"A", "B", "C"}, nil
+	})
+	lru := cache.NewLRU(4)
+	lru.Get("A")
+	metrics.RegisterCache(lru)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec,
+		httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "wiki_pages 3")
+	assert.Contains(t, rec.Body.String(), "wiki_cache_misses_total 1")
+	assert.Contains(t, rec.Body.String(), "wiki_cache_capacity 4")
+}
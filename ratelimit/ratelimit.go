@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneEvery bounds how many calls to Allow go by between sweeps for full
+// buckets, which are dropped since a new bucket starts full anyway.
+const pruneEvery = 1024
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a token bucket per key. Each bucket holds up to burst tokens
+// and refills at rate tokens per second.
+type Limiter struct {
+	mutex   sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	calls   int
+	Now     func() time.Time
+}
+
+func New(perMinute float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    perMinute / 60,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+		Now:     time.Now}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it
+// reports how long until the next token.
+func (self *Limiter) Allow(key string) (bool, time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := self.Now()
+	self.calls++
+	if self.calls%pruneEvery == 0 {
+		self.prune(now)
+	}
+	current, ok := self.buckets[key]
+	if !ok {
+		current = &bucket{tokens: self.burst, last: now}
+		self.buckets[key] = current
+	}
+	current.tokens = self.refill(current, now)
+	current.last = now
+	if current.tokens >= 1 {
+		current.tokens--
+		return true, 0
+	}
+	if self.rate <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+	wait := (1 - current.tokens) / self.rate
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
+
+func (self *Limiter) refill(current *bucket, now time.Time) float64 {
+	elapsed := now.Sub(current.last).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(self.burst, current.tokens+elapsed*self.rate)
+}
+
+func (self *Limiter) prune(now time.Time) {
+	for key, current := range self.buckets {
+		if self.refill(current, now) >= self.burst {
+			delete(self.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := New(6, 2)
+	limiter.Now = func() time.Time { return now }
+
+	ok, _ := limiter.Allow("a")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+	ok, wait := limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Second, wait)
+
+	// Keys have their own buckets.
+	ok, _ = limiter.Allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(4 * time.Second)
+	ok, wait = limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 6*time.Second, wait)
+	now = now.Add(6 * time.Second)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+}
+
+func TestPruneDropsFullBuckets(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := New(60, 1)
+	limiter.Now = func() time.Time { return now }
+	limiter.Allow("a")
+	now = now.Add(time.Minute)
+	limiter.prune(now)
+	assert.Empty(t, limiter.buckets)
+}
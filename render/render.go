@@ -0,0 +1,204 @@
+package render
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+// TOCMarker is replaced by the table of contents wherever it appears
+// first. Later copies are dropped.
+const TOCMarker = "[[_TOC_]]"
+
+const defaultTOCThreshold = 4
+
+var (
+	headingRegex = regexp.MustCompile(
+		`(?is)<h([1-6])(\s[^>]*)?>(.*?)</h[1-6]\s*>`)
+	idRegex   = regexp.MustCompile(`(?i)\bid\s*=\s*"([^"]*)"`)
+	tagRegex  = regexp.MustCompile(`<[^>]*>`)
+	linkRegex = regexp.MustCompile(
+		`\[\[([a-zA-Z0-9]+)(?:#([^\]|]*))?(?:\|([^\]]*))?\]\]`)
+	tagLinkRegex = regexp.MustCompile(`\[\[Tag:([a-zA-Z0-9_-]+)\]\]`)
+)
+
+type Options struct {
+	// TOCThreshold is how many headings a page needs for a table of
+	// contents without the marker. Zero means the default, negative never.
+	TOCThreshold int
+	// EditTitle, when set, follows each heading with a link to editing its
+	// section of that page.
+	EditTitle string
+	// Load, when set, expands transclusions.
+	Load Loader
+}
+
+func (self Options) threshold() int {
+	if self.TOCThreshold == 0 {
+		return defaultTOCThreshold
+	}
+	return self.TOCThreshold
+}
+
+type Heading struct {
+	Level  int
+	Anchor string
+	// Text is the heading's HTML with any tags removed.
+	Text string
+}
+
+// Slug turns heading text into an anchor: lower case letters and digits
+// joined by single dashes. The same text always gives the same anchor, so
+// links into sections keep working as the page around them changes.
+func Slug(text string) string {
+	text = html.UnescapeString(tagRegex.ReplaceAllString(text, ""))
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if slug.Len() == 0 {
+		return "section"
+	}
+	return slug.String()
+}
+
+// anchorHeadings gives every heading in body an id, keeping ids authors
+// set themselves. Repeated slugs get -2, -3, ... in order.
+func anchorHeadings(body []byte, editTitle string) ([]byte, []Heading) {
+	headings := []Heading{}
+	used := map[string]bool{}
+	for _, match := range idRegex.FindAllSubmatch(body, -1) {
+		used[string(match[1])] = true
+	}
+	anchored := headingRegex.ReplaceAllFunc(body, func(match []byte) []byte {
+		parts := headingRegex.FindSubmatch(match)
+		level, _ := strconv.Atoi(string(parts[1]))
+		text := strings.TrimSpace(tagRegex.ReplaceAllString(
+			string(parts[3]), ""))
+		edit := ""
+		if editTitle != "" {
+			edit = `<a href="/edit/` + editTitle + "?section=" +
+				strconv.Itoa(len(headings)+1) + `">edit</a>`
+		}
+		if id := idRegex.FindSubmatch(parts[2]); id != nil {
+			headings = append(headings, Heading{Level: level,
+				Anchor: string(id[1]), Text: text})
+			return append(append([]byte{}, match...), edit...)
+		}
+		anchor := Slug(text)
+		for n := 2; used[anchor]; n++ {
+			anchor = Slug(text) + "-" + strconv.Itoa(n)
+		}
+		used[anchor] = true
+		headings = append(headings, Heading{Level: level, Anchor: anchor,
+			Text: text})
+		return []byte("<h" + string(parts[1]) + ` id="` + anchor + `"` +
+			string(parts[2]) + ">" + string(parts[3]) + "</h" +
+			string(parts[1]) + ">" + edit)
+	})
+	return anchored, headings
+}
+
+// TOC lists headings as nested lists. A heading more than one level below
+// the previous one is only nested one level deeper.
+func TOC(headings []Heading) []byte {
+	if len(headings) == 0 {
+		return nil
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(`<div class="toc"><strong>Contents</strong>`)
+	top := headings[0].Level
+	for _, heading := range headings {
+		top = min(top, heading.Level)
+	}
+	open := 0
+	for _, heading := range headings {
+		level := max(1, min(heading.Level-top+1, open+1))
+		if level > open {
+			buffer.WriteString("<ul>")
+			open++
+		} else {
+			buffer.WriteString("</li>")
+			for ; open > level; open-- {
+				buffer.WriteString("</ul></li>")
+			}
+		}
+		buffer.WriteString(`<li><a href="#` + heading.Anchor + `">` +
+			heading.Text + "</a>")
+	}
+	buffer.WriteString("</li>")
+	for ; open > 1; open-- {
+		buffer.WriteString("</ul></li>")
+	}
+	buffer.WriteString("</ul></div>")
+	return buffer.Bytes()
+}
+
+// Links turns [[Title]], [[Title|label]] and [[Title#Section]] into links
+// to the view page, with sections slugged the way headings are, and
+// [[Tag:name]] into a link to the pages with that tag.
+func Links(body []byte) []byte {
+	body = tagLinkRegex.ReplaceAllFunc(body, func(match []byte) []byte {
+		tag := string(tagLinkRegex.FindSubmatch(match)[1])
+		return []byte(`<a href="/tags/` + strings.ToLower(tag) + `">` + tag +
+			"</a>")
+	})
+	return linkRegex.ReplaceAllFunc(body, func(match []byte) []byte {
+		parts := linkRegex.FindSubmatch(match)
+		title, section, label := string(parts[1]), string(parts[2]),
+			string(parts[3])
+		href := "/view/" + title
+		if section != "" {
+			href += "#" + Slug(section)
+		}
+		if label == "" {
+			label = title
+		}
+		return []byte(`<a href="` + href + `">` + label + "</a>")
+	})
+}
+
+// Sections anchors the headings of body and adds a table of contents where
+// the marker is, or at the top when there are enough headings.
+func Sections(body []byte, options Options) []byte {
+	body, headings := anchorHeadings(body, options.EditTitle)
+	toc := TOC(headings)
+	marker := []byte(TOCMarker)
+	if index := bytes.Index(body, marker); index >= 0 {
+		rest := bytes.ReplaceAll(body[index+len(marker):], marker, nil)
+		body = append(append(append([]byte{}, body[:index]...), toc...),
+			rest...)
+	} else if options.threshold() > 0 &&
+		len(headings) >= options.threshold() {
+		body = append(append([]byte{}, toc...), body...)
+	}
+	return body
+}
+
+// Page returns a copy of page with its body rendered for viewing, and the
+// titles it includes. Transclusion comes after sections, so headings of
+// included pages are not numbered as sections of this one. The result is
+// sanitized.
+func Page(page *types.Page, options Options) (*types.Page, []string) {
+	body := Sections(page.Body, options)
+	included := []string{}
+	if options.Load != nil {
+		body, included = Transclude(page.Title, body, options.Load)
+	}
+	return &types.Page{Title: page.Title, Body: Sanitize(Links(body)),
+		Meta: page.Meta}, included
+}
@@ -0,0 +1,93 @@
+package render
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "deploy-steps", Slug("Deploy  Steps"))
+	assert.Equal(t, "roll-back-v2", Slug("<em>Roll back</em> (v2)!"))
+	assert.Equal(t, "café-menu", Slug("Café &amp; Menu"))
+	assert.Equal(t, "section", Slug("?!"))
+}
+
+func TestSections(t *testing.T) {
+	body := []byte(`<h2>Setup</h2><h3 class="x">Install</h3><h3>Setup</h3>` +
+		`<h2 id="custom">Run</h2>`)
+	rendered := string(Sections(body, Options{}))
+	assert.True(t, strings.HasPrefix(rendered,
+		`<div class="toc"><strong>Contents</strong><ul>`+
+			`<li><a href="#setup">Setup</a><ul>`+
+			`<li><a href="#install">Install</a></li>`+
+			`<li><a href="#setup-2">Setup</a></li></ul></li>`+
+			`<li><a href="#custom">Run</a></li></ul></div>`), rendered)
+	assert.Contains(t, rendered, `<h3 id="install" class="x">Install</h3>`)
+	assert.Contains(t, rendered, `<h3 id="setup-2">Setup</h3>`)
+	assert.Contains(t, rendered, `<h2 id="custom">Run</h2>`)
+
+	// Below the threshold only the marker adds a table of contents.
+	short := []byte("Intro " + TOCMarker + "<h1>Only</h1>" + TOCMarker)
+	assert.Equal(t, `Intro <div class="toc"><strong>Contents</strong><ul>`+
+		`<li><a href="#only">Only</a></li></ul></div><h1 id="only">Only</h1>`,
+		string(Sections(short, Options{})))
+	assert.Equal(t, `<h1 id="only">Only</h1>`,
+		string(Sections([]byte("<h1>Only</h1>"), Options{})))
+	assert.NotContains(t, string(Sections(body, Options{TOCThreshold: -1})),
+		"toc")
+}
+
+func TestLinks(t *testing.T) {
+	assert.Equal(t, `See <a href="/view/Runbook#deploy-steps">Runbook</a>, `+
+		`<a href="/view/Oncall">paging</a> and <a href="/tags/ops">Ops</a>.`,
+		string(Links([]byte("See [[Runbook#Deploy Steps]], "+
+			"[[Oncall|paging]] and [[Tag:Ops]]."))))
+	assert.Equal(t, "[[Tag:]] [[Tag:a b]]",
+		string(Links([]byte("[[Tag:]] [[Tag:a b]]"))))
+}
+
+func TestSectionsAndEditLinks(t *testing.T) {
+	body := []byte("Lead\n<h2>A</h2>\na\n<h3>A1</h3>\na1\n<h2>B</h2>\nb\n")
+	section, err := Section(body, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "<h2>A</h2>\na\n<h3>A1</h3>\na1\n", string(section))
+	section, err = Section(body, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "<h3>A1</h3>\na1\n", string(section))
+	section, err = Section(body, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "Lead\n", string(section))
+	_, err = Section(body, 4)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	spliced, err := ReplaceSection(body, 3, []byte("<h2>B</h2>\nnew b"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Lead\n<h2>A</h2>\na\n<h3>A1</h3>\na1\n<h2>B</h2>\nnew b\n",
+		string(spliced))
+
+	rendered := string(Sections(body, Options{EditTitle: "Page"}))
+	assert.Contains(t, rendered,
+		`<h3 id="a1">A1</h3><a href="/edit/Page?section=2">edit</a>`)
+	assert.Contains(t, rendered,
+		`<h2 id="b">B</h2><a href="/edit/Page?section=3">edit</a>`)
+}
+
+func TestSanitize(t *testing.T) {
+	assert.Equal(t, `<p class="x">Hi <b>there</b></p>`,
+		string(Sanitize([]byte(`<p class="x" onclick="steal()">Hi `+
+			`<b>there</b></p>`))))
+	assert.Equal(t, "before after", string(Sanitize([]byte(
+		`before <script>fetch("/admin/restore")</script>`+
+			`<style>p{}</style>after`))))
+	assert.Equal(t, `<a>x</a><a href="/view/Home">y</a><img alt="z">`,
+		string(Sanitize([]byte(`<a href=" javascript:alert(1)">x</a>`+
+			`<a href="/view/Home">y</a><img src="data:x" alt="z">`))))
+	assert.Equal(t, "text &amp; &lt;tag&gt;",
+		string(Sanitize([]byte(`<form action="/x">text &amp; &lt;tag&gt;`+
+			`</form>`))))
+	assert.Equal(t, "", string(Sanitize([]byte(
+		`<svg><script>alert(1)</script></svg><!-- note -->`))))
+}
@@ -0,0 +1,92 @@
+package render
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedTags are the elements page bodies may use. Others are dropped but
+// keep their text, except droppedTags, which lose their content too.
+var (
+	allowedTags = setOf("a", "abbr", "b", "blockquote", "br", "caption",
+		"cite", "code", "col", "colgroup", "dd", "del", "details", "dfn",
+		"div", "dl", "dt", "em", "figcaption", "figure", "h1", "h2", "h3",
+		"h4", "h5", "h6", "hr", "i", "img", "ins", "kbd", "li", "mark", "ol",
+		"p", "pre", "q", "s", "samp", "small", "span", "strong", "sub",
+		"summary", "sup", "table", "tbody", "td", "tfoot", "th", "thead",
+		"tr", "u", "ul", "var")
+	droppedTags = setOf("script", "style", "iframe", "object", "applet",
+		"noscript", "noembed", "noframes", "template", "xmp", "plaintext",
+		"svg", "math")
+	allowedAttributes = setOf("id", "class", "title", "lang", "dir", "href",
+		"name", "src", "alt", "width", "height", "colspan", "rowspan",
+		"align", "start", "open", "cite", "datetime")
+	urlAttributes = setOf("href", "src", "cite")
+	safeSchemes   = setOf("", "http", "https", "mailto")
+)
+
+func setOf(names ...string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+func safeURL(value string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(value))
+	return err == nil && safeSchemes[strings.ToLower(parsed.Scheme)]
+}
+
+// Sanitize keeps only the markup in allowedTags, with allowedAttributes
+// and links to http, https, mailto or this wiki. Page bodies are authored
+// by anyone and served on the same origin as the admin pages, so script in
+// them could act for whoever views them.
+func Sanitize(body []byte) []byte {
+	var buffer bytes.Buffer
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	dropped := 0
+	for {
+		kind := tokenizer.Next()
+		if kind == html.ErrorToken {
+			return buffer.Bytes()
+		}
+		token := tokenizer.Token()
+		switch kind {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedTags[token.Data] {
+				if kind == html.StartTagToken {
+					dropped++
+				}
+				continue
+			}
+			if dropped > 0 || !allowedTags[token.Data] {
+				continue
+			}
+			buffer.WriteString("<" + token.Data)
+			for _, attribute := range token.Attr {
+				if attribute.Namespace != "" ||
+					!allowedAttributes[attribute.Key] ||
+					urlAttributes[attribute.Key] && !safeURL(attribute.Val) {
+					continue
+				}
+				buffer.WriteString(" " + attribute.Key + `="` +
+					html.EscapeString(attribute.Val) + `"`)
+			}
+			buffer.WriteString(">")
+		case html.EndTagToken:
+			if droppedTags[token.Data] {
+				dropped = max(dropped-1, 0)
+			} else if dropped == 0 && allowedTags[token.Data] {
+				buffer.WriteString("</" + token.Data + ">")
+			}
+		case html.TextToken:
+			if dropped == 0 {
+				buffer.WriteString(html.EscapeString(token.Data))
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type span struct {
+	start int
+	end   int
+}
+
+// sections splits body the way section numbers count it: section 0 is
+// the text before the first heading and section n runs from the nth
+// heading to the next heading at the same or a higher level, so it
+// includes its subsections.
+func sections(body []byte) []span {
+	matches := headingRegex.FindAllSubmatchIndex(body, -1)
+	first := len(body)
+	if len(matches) > 0 {
+		first = matches[0][0]
+	}
+	spans := []span{{start: 0, end: first}}
+	for i, match := range matches {
+		level, _ := strconv.Atoi(string(body[match[2]:match[3]]))
+		end := len(body)
+		for _, next := range matches[i+1:] {
+			nextLevel, _ := strconv.Atoi(string(body[next[2]:next[3]]))
+			if nextLevel <= level {
+				end = next[0]
+				break
+			}
+		}
+		spans = append(spans, span{start: match[0], end: end})
+	}
+	return spans
+}
+
+func sectionSpan(body []byte, n int) (span, error) {
+	spans := sections(body)
+	if n < 0 || n >= len(spans) {
+		return span{}, fmt.Errorf("section %d: %w", n, os.ErrNotExist)
+	}
+	return spans[n], nil
+}
+
+// Section returns section n of body, heading included. A missing section
+// is an error wrapping os.ErrNotExist.
+func Section(body []byte, n int) ([]byte, error) {
+	section, err := sectionSpan(body, n)
+	if err != nil {
+		return nil, err
+	}
+	return body[section.start:section.end], nil
+}
+
+// ReplaceSection splices text in place of section n of body. A textarea
+// drops the newline that separated the section from the next one, so it
+// is put back.
+func ReplaceSection(body []byte, n int, text []byte) ([]byte, error) {
+	section, err := sectionSpan(body, n)
+	if err != nil {
+		return nil, err
+	}
+	old := body[section.start:section.end]
+	if bytes.HasSuffix(old, []byte("\n")) &&
+		!bytes.HasSuffix(text, []byte("\n")) {
+		text = append(append([]byte{}, text...), '\n')
+	}
+	spliced := append([]byte{}, body[:section.start]...)
+	spliced = append(spliced, text...)
+	return append(spliced, body[section.end:]...), nil
+}
@@ -0,0 +1,154 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+// TemplatePrefix is prepended to the name in {{Template:Name}}, since
+// titles cannot hold a namespace: {{Template:Warning}} includes the page
+// TemplateWarning.
+const TemplatePrefix = "Template"
+
+const maxIncludeDepth = 8
+
+var (
+	includeRegex = regexp.MustCompile(
+		`\{\{(include|Template):([a-zA-Z0-9]+)((?:\|[^{}]*)?)\}\}`)
+	parameterRegex = regexp.MustCompile(
+		`\{\{\{([^{}|]+)(?:\|([^{}]*))?\}\}\}`)
+)
+
+// Loader returns the page a transclusion names.
+type Loader func(title string) (*types.Page, error)
+
+func includeError(format string, args ...interface{}) []byte {
+	return []byte(`<strong class="error">` +
+		html.EscapeString(fmt.Sprintf(format, args...)) + "</strong>")
+}
+
+// arguments reads |name=value and positional |value arguments, the latter
+// numbered from 1.
+func arguments(raw string) map[string]string {
+	values := map[string]string{}
+	if raw == "" {
+		return values
+	}
+	position := 0
+	for _, argument := range strings.Split(raw[1:], "|") {
+		if name, value, ok := strings.Cut(argument, "="); ok {
+			values[strings.TrimSpace(name)] = value
+		} else {
+			position++
+			values[strconv.Itoa(position)] = argument
+		}
+	}
+	return values
+}
+
+// substitute fills {{{name}}} and {{{name|default}}} from values. Missing
+// parameters without a default are left as they are, so they show up.
+func substitute(body []byte, values map[string]string) []byte {
+	return parameterRegex.ReplaceAllFunc(body, func(match []byte) []byte {
+		parts := parameterRegex.FindSubmatch(match)
+		if value, ok := values[strings.TrimSpace(string(parts[1]))]; ok {
+			return []byte(value)
+		}
+		if parts[2] != nil {
+			return parts[2]
+		}
+		return match
+	})
+}
+
+// A render stops expanding after maxIncludes transclusions or once they
+// have added maxIncludeBytes, so a few small pages including each other
+// many times over cannot blow up one view.
+const (
+	maxIncludes     = 100
+	maxIncludeBytes = 1 << 20
+)
+
+type loaded struct {
+	page *types.Page
+	err  error
+}
+
+// transclusion is the state of one render: each title is loaded at most
+// once, and every expansion counts against the budget.
+type transclusion struct {
+	load       Loader
+	pages      map[string]loaded
+	included   map[string]bool
+	expansions int
+	bytes      int
+}
+
+func (self *transclusion) page(title string) (*types.Page, error) {
+	if cached, ok := self.pages[title]; ok {
+		return cached.page, cached.err
+	}
+	page, err := self.load(title)
+	self.pages[title] = loaded{page: page, err: err}
+	return page, err
+}
+
+func (self *transclusion) expand(body []byte, stack []string) []byte {
+	return includeRegex.ReplaceAllFunc(body, func(match []byte) []byte {
+		parts := includeRegex.FindSubmatch(match)
+		title := string(parts[2])
+		if string(parts[1]) == "Template" {
+			title = TemplatePrefix + title
+		}
+		self.included[title] = true
+		for _, open := range stack {
+			if open == title {
+				return includeError("%s includes itself", title)
+			}
+		}
+		if len(stack) > maxIncludeDepth {
+			return includeError("includes nest deeper than %d pages",
+				maxIncludeDepth)
+		}
+		if self.expansions >= maxIncludes {
+			return includeError("more than %d includes", maxIncludes)
+		}
+		page, err := self.page(title)
+		if err != nil {
+			return includeError("cannot include %s", title)
+		}
+		expanded := substitute(page.Body, arguments(string(parts[3])))
+		if self.bytes+len(expanded) > maxIncludeBytes {
+			return includeError("includes add more than %d bytes",
+				maxIncludeBytes)
+		}
+		self.expansions++
+		self.bytes += len(expanded)
+		return self.expand(expanded,
+			append(stack[:len(stack):len(stack)], title))
+	})
+}
+
+// Transclude expands {{include:Title}} and {{Template:Name}}, with their
+// |arguments, in the body of the page titled title. Included pages are
+// expanded in turn. A page that includes itself, directly or not,
+// nesting past maxIncludeDepth or going over the include budget renders an
+// error in place. It returns every title it tried to include, so
+// renderings can be dropped when one changes or is created.
+func Transclude(title string, body []byte, load Loader) ([]byte, []string) {
+	state := &transclusion{load: load, pages: map[string]loaded{},
+		included: map[string]bool{}}
+	expanded := state.expand(body, []string{title})
+	titles := []string{}
+	for title := range state.included {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+	return expanded, titles
+}
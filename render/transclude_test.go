@@ -0,0 +1,89 @@
+package render
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func loader(pages map[string]string) Loader {
+	return func(title string) (*types.Page, error) {
+		body, ok := pages[title]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return &types.Page{Title: title, Body: []byte(body)}, nil
+	}
+}
+
+func TestTransclude(t *testing.T) {
+	load := loader(map[string]string{
+		"Contacts":        "Call {{include:Pager}}.",
+		"Pager":           "555-0100",
+		"TemplateWarning": "<b>{{{level|Note}}}:</b> {{{1}}} {{{missing}}}",
+		"Loop":            "Loop {{include:Back}}",
+		"Back":            "Back {{include:Loop}}"})
+
+	body, included := Transclude("Runbook", []byte(
+		"{{include:Contacts}} {{Template:Warning|level=Caution|Do not panic}}"+
+			" {{Template:Warning|Relax}} {{include:Gone}}"), load)
+	assert.Equal(t, "Call 555-0100. <b>Caution:</b> Do not panic "+
+		"{{{missing}}} <b>Note:</b> Relax {{{missing}}} "+
+		`<strong class="error">cannot include Gone</strong>`, string(body))
+	assert.Equal(t, []string{"Contacts", "Gone", "Pager", "TemplateWarning"},
+		included)
+
+	body, _ = Transclude("Loop", []byte("{{include:Back}}"), load)
+	assert.Equal(t, `Back <strong class="error">Loop includes itself</strong>`,
+		string(body))
+	body, _ = Transclude("Runbook", []byte("{{include:Runbook}}"), load)
+	assert.Contains(t, string(body), "Runbook includes itself")
+}
+
+func TestTranscludeDepth(t *testing.T) {
+	pages := map[string]string{}
+	for i := 0; i < 20; i++ {
+		pages["P"+string(rune('a'+i))] = "{{include:P" + string(rune('a'+i+1)) +
+			"}}"
+	}
+	body, _ := Transclude("Top", []byte("{{include:Pa}}"), loader(pages))
+	assert.Contains(t, string(body), "includes nest deeper than 8 pages")
+}
+
+func TestTranscludeBudget(t *testing.T) {
+	loads := map[string]int{}
+	pages := map[string]string{"P8": "x"}
+	for i := 0; i < 8; i++ {
+		next := "{{include:P" + strconv.Itoa(i+1) + "}}"
+		pages["P"+strconv.Itoa(i)] = strings.Repeat(next, 50)
+	}
+	load := func(title string) (*types.Page, error) {
+		loads[title]++
+		return loader(pages)(title)
+	}
+	body, _ := Transclude("Top", []byte("{{include:P0}}"), load)
+	assert.Contains(t, string(body), "more than 100 includes")
+	for title, count := range loads {
+		assert.Equal(t, 1, count, title)
+	}
+
+	pages = map[string]string{"Big": strings.Repeat("x", 600<<10)}
+	body, _ = Transclude("Top", []byte("{{include:Big}}{{include:Big}}"),
+		loader(pages))
+	assert.Contains(t, string(body), "includes add more than 1048576 bytes")
+}
+
+func TestPageIncludesAfterSections(t *testing.T) {
+	load := loader(map[string]string{"Snippet": "<h2>Inner</h2>[[Home]]"})
+	page, included := Page(&types.Page{Title: "Outer",
+		Body: []byte("<h2>Outer</h2>{{include:Snippet}}")},
+		Options{EditTitle: "Outer", Load: load})
+	assert.Equal(t, []string{"Snippet"}, included)
+	assert.Equal(t, `<h2 id="outer">Outer</h2>`+
+		`<a href="/edit/Outer?section=1">edit</a>`+
+		`<h2>Inner</h2><a href="/view/Home">Home</a>`, string(page.Body))
+}
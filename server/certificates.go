@@ -0,0 +1,158 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// CertReloader serves the certificate in CertFile and KeyFile, loading it
+// again when either file changes. A pair that fails to load is logged and
+// the previous certificate kept, so a half-finished renewal never takes
+// the server down.
+type CertReloader struct {
+	CertFile string
+	KeyFile  string
+	// Interval is how often handshakes check the files for changes.
+	Interval time.Duration
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	stamp       string
+	checked     time.Time
+}
+
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{CertFile: certFile, KeyFile: keyFile,
+		Interval: time.Second}
+	stamp, err := reloader.fileStamp()
+	if err != nil {
+		return nil, err
+	}
+	if err = reloader.load(stamp); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// fileStamp changes whenever either file is replaced or rewritten.
+func (self *CertReloader) fileStamp() (string, error) {
+	stamp := ""
+	for _, file := range []string{self.CertFile, self.KeyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		stamp += info.ModTime().String() + "/" +
+			strconv.FormatInt(info.Size(), 10) + ";"
+	}
+	return stamp, nil
+}
+
+func (self *CertReloader) load(stamp string) error {
+	certificate, err := tls.LoadX509KeyPair(self.CertFile, self.KeyFile)
+	if err != nil {
+		return err
+	}
+	self.certificate = &certificate
+	self.stamp = stamp
+	return nil
+}
+
+func (self *CertReloader) GetCertificate(
+	hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(self.checked) < self.Interval {
+		return self.certificate, nil
+	}
+	self.checked = now
+	stamp, err := self.fileStamp()
+	if err != nil {
+		slog.Error("failed to check certificate", "cert", self.CertFile,
+			"error", err)
+		return self.certificate, nil
+	}
+	if stamp == self.stamp {
+		return self.certificate, nil
+	}
+	if err = self.load(stamp); err != nil {
+		slog.Error("failed to reload certificate", "cert", self.CertFile,
+			"error", err)
+	} else {
+		slog.Info("reloaded certificate", "cert", self.CertFile)
+	}
+	return self.certificate, nil
+}
+
+// SelfSigned writes a certificate for localhost to certFile and keyFile
+// unless both already exist. It is meant for development only.
+func SelfSigned(certFile string, keyFile string) error {
+	if util.Exists(certFile) && util.Exists(keyFile) {
+		return nil
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	hosts := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		hosts = append(hosts, hostname)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"Wiki development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              hosts,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	for _, file := range []string{certFile, keyFile} {
+		if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+		Type: "PRIVATE KEY", Bytes: private}), 0600)
+	if err != nil {
+		return err
+	}
+	slog.Warn("generated a self-signed development certificate",
+		"cert", certFile)
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: der}), 0644)
+}
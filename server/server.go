@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+const (
+	defaultAddress    = ":8080"
+	defaultTLSAddress = ":8443"
+)
+
+// Timeouts keep slow or idle clients from holding connections open. Reads
+// and writes are generous since restores upload and exports download
+// whole wikis.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 5 * time.Minute
+	writeTimeout      = 10 * time.Minute
+	idleTimeout       = 2 * time.Minute
+)
+
+func newServer(address string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout}
+}
+
+// HSTS tells browsers that reached the wiki over HTTPS to keep using it
+// for maxAge, on subdomains as well with includeSubdomains.
+func HSTS(
+	maxAge time.Duration,
+	includeSubdomains bool,
+	next http.Handler) http.Handler {
+	value := "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return http.HandlerFunc(func(
+		writter http.ResponseWriter,
+		request *http.Request) {
+		if request.TLS != nil {
+			writter.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(writter, request)
+	})
+}
+
+// Redirect sends every request to the same host and path on the HTTPS
+// listener at httpsAddress.
+func Redirect(httpsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+	return http.HandlerFunc(func(
+		writter http.ResponseWriter,
+		request *http.Request) {
+		host := request.Host
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(writter, request,
+			"https://"+host+request.URL.RequestURI(),
+			http.StatusMovedPermanently)
+	})
+}
+
+// certificateFiles returns the configured pair, defaulting to
+// <doc_root>/.tls in self-signed mode.
+func certificateFiles(config types.Server) (string, string) {
+	certFile, keyFile := config.TLS.Cert, config.TLS.Key
+	if config.TLS.SelfSigned {
+		if certFile == "" {
+			certFile = filepath.Join(config.DocRoot, ".tls", "cert.pem")
+		}
+		if keyFile == "" {
+			keyFile = filepath.Join(config.DocRoot, ".tls", "key.pem")
+		}
+	}
+	return certFile, keyFile
+}
+
+// ListenAndServe serves handler over HTTPS when config names a certificate
+// or asks for a self-signed one, and over plain HTTP otherwise.
+func ListenAndServe(config types.Server, handler http.Handler) error {
+	certFile, keyFile := certificateFiles(config)
+	if certFile == "" && keyFile == "" {
+		address := config.Address
+		if address == "" {
+			address = defaultAddress
+		}
+		slog.Info("serving HTTP", "address", address)
+		return newServer(address, handler).ListenAndServe()
+	}
+	if certFile == "" || keyFile == "" {
+		return fmt.Errorf("tls needs both a cert and a key")
+	}
+
+	if config.TLS.SelfSigned {
+		if err := SelfSigned(certFile, keyFile); err != nil {
+			return err
+		}
+	}
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	if config.TLS.HSTSMaxAge != "" {
+		maxAge, err := time.ParseDuration(config.TLS.HSTSMaxAge)
+		if err != nil {
+			return fmt.Errorf("hsts_max_age: %w", err)
+		}
+		handler = HSTS(maxAge, config.TLS.HSTSIncludeSubdomains, handler)
+	}
+	address := config.Address
+	if address == "" {
+		address = defaultTLSAddress
+	}
+	secure := newServer(address, handler)
+	secure.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate}
+
+	failed := make(chan error, 2)
+	if config.TLS.RedirectAddress != "" {
+		go func() {
+			slog.Info("redirecting HTTP to HTTPS",
+				"address", config.TLS.RedirectAddress)
+			failed <- newServer(config.TLS.RedirectAddress,
+				Redirect(address)).ListenAndServe()
+		}()
+	}
+	go func() {
+		slog.Info("serving HTTPS", "address", address, "cert", certFile)
+		failed <- secure.ListenAndServeTLS("", "")
+	}()
+	return <-failed
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serial(t *testing.T, certificate *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	assert.NoError(t, err)
+	return parsed.SerialNumber.String()
+}
+
+func TestSelfSignedAndReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls", "cert.pem")
+	keyFile := filepath.Join(dir, "tls", "key.pem")
+	assert.NoError(t, SelfSigned(certFile, keyFile))
+	before, err := os.ReadFile(certFile)
+	assert.NoError(t, err)
+	// Existing files are kept.
+	assert.NoError(t, SelfSigned(certFile, keyFile))
+	after, _ := os.ReadFile(certFile)
+	assert.Equal(t, before, after)
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	assert.NoError(t, err)
+	reloader.Interval = 0
+	first, err := reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	parsed, err := x509.ParseCertificate(first.Certificate[0])
+	assert.NoError(t, err)
+	assert.NoError(t, parsed.VerifyHostname("localhost"))
+
+	// A broken pair keeps the old certificate.
+	assert.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0644))
+	kept, err := reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, serial(t, first), serial(t, kept))
+
+	assert.NoError(t, os.Remove(certFile))
+	assert.NoError(t, os.Remove(keyFile))
+	assert.NoError(t, SelfSigned(certFile, keyFile))
+	future := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(certFile, future, future))
+	renewed, err := reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, serial(t, first), serial(t, renewed))
+}
+
+func TestRedirect(t *testing.T) {
+	cases := map[string][2]string{
+		"wiki.example:8080":  {":443", "https://wiki.example/view/Home?x=1"},
+		"wiki.example":       {":8443", "https://wiki.example:8443/view/Home?x=1"},
+		"[::1]:8080":         {":8443", "https://[::1]:8443/view/Home?x=1"},
+		"[2001:db8::1]:8080": {":443", "https://[2001:db8::1]/view/Home?x=1"}}
+	for host, expected := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/view/Home?x=1", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		Redirect(expected[0]).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		assert.Equal(t, expected[1], rec.Header().Get("Location"), host)
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	handler := HSTS(24*time.Hour, true, http.HandlerFunc(
+		func(writter http.ResponseWriter, request *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Empty(t, rec.Header().Get("Strict-Transport-Security"))
+
+	req.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "max-age=86400; includeSubDomains",
+		rec.Header().Get("Strict-Transport-Security"))
+
+	// Sibling subdomains without TLS are left alone by default.
+	handler = HSTS(24*time.Hour, false, http.HandlerFunc(
+		func(writter http.ResponseWriter, request *http.Request) {}))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "max-age=86400",
+		rec.Header().Get("Strict-Transport-Security"))
+}
+
+func TestServerTimeouts(t *testing.T) {
+	server := newServer(":0", http.NotFoundHandler())
+	assert.Equal(t, readHeaderTimeout, server.ReadHeaderTimeout)
+	assert.NotZero(t, server.ReadTimeout)
+	assert.NotZero(t, server.WriteTimeout)
+	assert.NotZero(t, server.IdleTimeout)
+}
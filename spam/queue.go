@@ -0,0 +1,120 @@
+package spam
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var idRegex = regexp.MustCompile("^[0-9a-f]{16}$")
+
+// Held is an edit the filters rejected, waiting for an admin.
+type Held struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Source  string `json:"source"`
+	Summary string `json:"summary"`
+	Minor   bool   `json:"minor"`
+	Author  string `json:"author"`
+	IP      string `json:"ip"`
+	Reason  string `json:"reason"`
+	// Revision is the page revision Source was built on; approving
+	// conflicts with any save since.
+	Revision int       `json:"revision"`
+	Received time.Time `json:"received"`
+}
+
+// Queue keeps held edits as <root>/.moderation/<id>.json.
+type Queue struct {
+	Root string
+
+	mutex sync.Mutex
+}
+
+func NewQueue(root string) *Queue {
+	return &Queue{Root: filepath.Join(root, ".moderation")}
+}
+
+func (self *Queue) file(id string) (string, error) {
+	if !idRegex.MatchString(id) {
+		return "", fmt.Errorf("invalid moderation id %q: %w", id,
+			os.ErrNotExist)
+	}
+	return filepath.Join(self.Root, id+".json"), nil
+}
+
+func (self *Queue) Hold(held Held) (Held, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return held, err
+	}
+	held.ID = hex.EncodeToString(random)
+	content, err := json.MarshalIndent(held, "", "  ")
+	if err != nil {
+		return held, err
+	}
+	if err = os.MkdirAll(self.Root, 0700); err != nil {
+		return held, err
+	}
+	path, _ := self.file(held.ID)
+	return held, os.WriteFile(path, content, 0600)
+}
+
+func (self *Queue) Get(id string) (Held, error) {
+	held := Held{}
+	path, err := self.file(id)
+	if err != nil {
+		return held, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return held, err
+	}
+	err = json.Unmarshal(content, &held)
+	return held, err
+}
+
+// List returns the held edits, oldest first.
+func (self *Queue) List() ([]Held, error) {
+	entries, err := os.ReadDir(self.Root)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Held{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	all := []Held{}
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if !idRegex.MatchString(id) {
+			continue
+		}
+		held, err := self.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, held)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Received.Before(all[j].Received)
+	})
+	return all, nil
+}
+
+func (self *Queue) Remove(id string) error {
+	path, err := self.file(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,150 @@
+package spam
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+var externalLinkRegex = regexp.MustCompile(`https?://[^\s"'<>|\])]+`)
+
+// Submission is an edit as the save form sent it.
+type Submission struct {
+	Title  string
+	Source []byte
+	// Honeypot is a form field hidden from people, so only bots fill it.
+	Honeypot string
+	// Started is when the edit form was served, zero when the form did not
+	// carry a stamp that verifies.
+	Started  time.Time
+	Received time.Time
+	IP       string
+}
+
+// Filter returns why a submission looks like spam, or nil.
+type Filter interface {
+	Check(submission Submission) error
+}
+
+// Chain runs filters in order and stops at the first rejection.
+type Chain []Filter
+
+func (self Chain) Check(submission Submission) error {
+	for _, filter := range self {
+		if err := filter.Check(submission); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Honeypot struct{}
+
+func (self Honeypot) Check(submission Submission) error {
+	if submission.Honeypot != "" {
+		return fmt.Errorf("honeypot field was filled in")
+	}
+	return nil
+}
+
+type LinkCount struct {
+	Max int
+}
+
+func (self LinkCount) Check(submission Submission) error {
+	count := len(externalLinkRegex.FindAll(submission.Source, -1))
+	if count > self.Max {
+		return fmt.Errorf("%d external links, at most %d allowed", count,
+			self.Max)
+	}
+	return nil
+}
+
+// BlockedDomains rejects links to any of Domains or their subdomains.
+type BlockedDomains struct {
+	Domains []string
+}
+
+func (self BlockedDomains) Check(submission Submission) error {
+	for _, link := range externalLinkRegex.FindAll(submission.Source, -1) {
+		parsed, err := url.Parse(string(link))
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(parsed.Hostname())
+		for _, domain := range self.Domains {
+			domain = strings.ToLower(domain)
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return fmt.Errorf("links to blocked domain %s", domain)
+			}
+		}
+	}
+	return nil
+}
+
+type BlockedPatterns struct {
+	Patterns []*regexp.Regexp
+}
+
+func (self BlockedPatterns) Check(submission Submission) error {
+	for _, pattern := range self.Patterns {
+		if pattern.Match(submission.Source) {
+			return fmt.Errorf("matches blocked pattern %s", pattern)
+		}
+	}
+	return nil
+}
+
+// MinimumTime rejects forms sent back sooner than Duration after they were
+// served, and forms that do not say when they were served.
+type MinimumTime struct {
+	Duration time.Duration
+}
+
+func (self MinimumTime) Check(submission Submission) error {
+	if submission.Started.IsZero() {
+		return fmt.Errorf("edit form did not say when it was served")
+	}
+	if elapsed := submission.Received.Sub(submission.Started); elapsed <
+		self.Duration {
+		return fmt.Errorf("submitted %s after the form was served",
+			elapsed.Round(time.Second))
+	}
+	return nil
+}
+
+// NewChain builds the filters config asks for. The honeypot is always
+// checked; the others only when configured.
+func NewChain(config types.Spam) (Chain, error) {
+	chain := Chain{Honeypot{}}
+	if config.MaxLinks > 0 {
+		chain = append(chain, LinkCount{Max: config.MaxLinks})
+	}
+	if len(config.BlockedDomains) > 0 {
+		chain = append(chain, BlockedDomains{Domains: config.BlockedDomains})
+	}
+	if len(config.BlockedPatterns) > 0 {
+		patterns := BlockedPatterns{}
+		for _, expression := range config.BlockedPatterns {
+			pattern, err := regexp.Compile(expression)
+			if err != nil {
+				return nil, fmt.Errorf("blocked pattern %q: %w", expression,
+					err)
+			}
+			patterns.Patterns = append(patterns.Patterns, pattern)
+		}
+		chain = append(chain, patterns)
+	}
+	if config.MinimumTime != "" {
+		duration, err := time.ParseDuration(config.MinimumTime)
+		if err != nil {
+			return nil, fmt.Errorf("minimum time: %w", err)
+		}
+		chain = append(chain, MinimumTime{Duration: duration})
+	}
+	return chain, nil
+}
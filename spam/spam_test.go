@@ -0,0 +1,96 @@
+package spam
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewChain(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	chain, err := NewChain(types.Spam{
+		MaxLinks:        2,
+		BlockedDomains:  []string{"spam.example"},
+		BlockedPatterns: []string{"(?i)cheap pills"},
+		MinimumTime:     "5s"})
+	assert.NoError(t, err)
+	valid := Submission{Source: []byte("See https://example.com."),
+		Started: now.Add(-time.Minute), Received: now}
+	assert.NoError(t, chain.Check(valid))
+
+	cases := map[string]func(*Submission){
+		"honeypot": func(s *Submission) { s.Honeypot = "http://x" },
+		"links": func(s *Submission) {
+			s.Source = []byte("http://a.com http://b.com http://c.com")
+		},
+		"domain": func(s *Submission) {
+			s.Source = []byte("[[https://www.SPAM.example/buy]]")
+		},
+		"pattern": func(s *Submission) { s.Source = []byte("Cheap Pills!") },
+		"too fast": func(s *Submission) {
+			s.Started = now.Add(-time.Second)
+		},
+		"no start": func(s *Submission) { s.Started = time.Time{} }}
+	for name, change := range cases {
+		submission := valid
+		change(&submission)
+		assert.Error(t, chain.Check(submission), name)
+	}
+
+	_, err = NewChain(types.Spam{BlockedPatterns: []string{"("}})
+	assert.Error(t, err)
+	_, err = NewChain(types.Spam{MinimumTime: "soon"})
+	assert.Error(t, err)
+}
+
+func TestQueue(t *testing.T) {
+	queue := NewQueue(t.TempDir())
+	all, err := queue.List()
+	assert.NoError(t, err)
+	assert.Empty(t, all)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second, err := queue.Hold(Held{Title: "B", Received: now.Add(time.Hour)})
+	assert.NoError(t, err)
+	first, err := queue.Hold(Held{Title: "A", Source: "Body.", Received: now})
+	assert.NoError(t, err)
+	all, err = queue.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first.ID, second.ID},
+		[]string{all[0].ID, all[1].ID})
+
+	held, err := queue.Get(first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Body.", held.Source)
+	assert.NoError(t, queue.Remove(first.ID))
+	_, err = queue.Get(first.ID)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	_, err = queue.Get("../../settings")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestStamp(t *testing.T) {
+	root := t.TempDir()
+	key, err := LoadKey(root)
+	assert.NoError(t, err)
+	again, err := LoadKey(root)
+	assert.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	served := time.Unix(1700000000, 0)
+	stamp := Stamp(key, served)
+	parsed, err := ParseStamp(key, stamp)
+	assert.NoError(t, err)
+	assert.True(t, served.Equal(parsed))
+
+	_, err = ParseStamp(key, "1")
+	assert.Error(t, err)
+	_, err = ParseStamp(key, "1."+stamp[len("1700000000."):])
+	assert.Error(t, err)
+	_, err = ParseStamp([]byte("other"), stamp)
+	assert.Error(t, err)
+}
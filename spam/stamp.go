@@ -0,0 +1,74 @@
+package spam
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const keySize = 32
+
+// LoadKey returns the key edit form stamps are signed with, kept in
+// <root>/.form-key so forms outlive a restart. It is created on first use.
+func LoadKey(root string) ([]byte, error) {
+	path := filepath.Join(root, ".form-key")
+	key, err := os.ReadFile(path)
+	if err == nil && len(key) == keySize {
+		return key, nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key = make([]byte, keySize)
+	if _, err = rand.Read(key); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		// Another process won the race; use its key.
+		return os.ReadFile(path)
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err = file.Write(key); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return key, file.Close()
+}
+
+func sign(key []byte, seconds string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(seconds))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Stamp records when a form was served as <unix seconds>.<signature>.
+func Stamp(key []byte, served time.Time) string {
+	seconds := strconv.FormatInt(served.Unix(), 10)
+	return seconds + "." + sign(key, seconds)
+}
+
+// ParseStamp returns when a stamp says its form was served, or an error
+// when it is missing or was not signed with key.
+func ParseStamp(key []byte, stamp string) (time.Time, error) {
+	seconds, signature, ok := strings.Cut(stamp, ".")
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid form stamp %q", stamp)
+	}
+	if !hmac.Equal([]byte(sign(key, seconds)), []byte(signature)) {
+		return time.Time{}, errors.New("form stamp signature does not match")
+	}
+	served, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid form stamp %q", stamp)
+	}
+	return time.Unix(served, 0), nil
+}
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+var (
+	pagesBucket     = []byte("pages")
+	revisionsBucket = []byte("revisions")
+	linksBucket     = []byte("links")
+)
+
+type storedRevision struct {
+	Revision  types.Revision `json:"revision"`
+	Source    []byte         `json:"source"`
+	VersionID string         `json:"version_id,omitempty"`
+}
+
+// ErrLocked is returned when another process, like a running server, has
+// the bbolt file open. bbolt locks the whole file, so wikictl can only use
+// a bolt store while the server is stopped.
+var ErrLocked = errors.New("store is open in another process; stop the " +
+	"server first")
+
+// Bolt keeps everything in one bbolt file. Each save updates the page, its
+// revision and its outgoing links in a single transaction.
+type Bolt struct {
+	Path string
+	DB   *bolt.DB
+}
+
+func NewBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s: %w", path, ErrLocked)
+	} else if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{pagesBucket, revisionsBucket,
+			linksBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{Path: path, DB: db}, nil
+}
+
+func (self *Bolt) Close() error {
+	return self.DB.Close()
+}
+
+func revisionKey(number int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(number))
+	return key
+}
+
+func notFound(what string) error {
+	return fmt.Errorf("%s: %w", what, os.ErrNotExist)
+}
+
+func parseSource(title string, source []byte) *types.Page {
+	meta, body, err := util.ParseFrontMatter(source)
+	if err != nil {
+		meta, body = nil, source
+	}
+	return &types.Page{Title: title, Body: body, Meta: meta}
+}
+
+func (self *Bolt) Titles() ([]string, error) {
+	titles := []string{}
+	err := self.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pagesBucket).ForEach(func(key []byte, _ []byte) error {
+			titles = append(titles, string(key))
+			return nil
+		})
+	})
+	return titles, err
+}
+
+func (self *Bolt) Load(title string) (*types.Page, error) {
+	var page *types.Page
+	err := self.DB.View(func(tx *bolt.Tx) error {
+		source := tx.Bucket(pagesBucket).Get([]byte(title))
+		if source == nil {
+			return notFound(title)
+		}
+		page = parseSource(title, source)
+		return nil
+	})
+	return page, err
+}
+
+func (self *Bolt) Save(page *types.Page, revision *types.Revision) error {
+	source, err := util.Source(page)
+	if err != nil {
+		return err
+	}
+	links, err := json.Marshal(util.ExtractLinks(page.Body))
+	if err != nil {
+		return err
+	}
+	return self.DB.Update(func(tx *bolt.Tx) error {
+		revisions, err := tx.Bucket(revisionsBucket).CreateBucketIfNotExists(
+			[]byte(page.Title))
+		if err != nil {
+			return err
+		}
+		revision.Title = page.Title
+		revision.Number = 1
+		if last, _ := revisions.Cursor().Last(); last != nil {
+			revision.Number = int(binary.BigEndian.Uint64(last)) + 1
+		}
+		value, err := json.Marshal(storedRevision{Revision: *revision, Source: source})
+		if err != nil {
+			return err
+		}
+		if err = revisions.Put(revisionKey(revision.Number), value); err != nil {
+			return err
+		}
+		if err = tx.Bucket(pagesBucket).Put([]byte(page.Title),
+			source); err != nil {
+			return err
+		}
+		return tx.Bucket(linksBucket).Put([]byte(page.Title), links)
+	})
+}
+
+// Delete drops the page and its links but keeps its revisions.
+func (self *Bolt) Delete(title string, revision *types.Revision) error {
+	return self.DB.Update(func(tx *bolt.Tx) error {
+		pages := tx.Bucket(pagesBucket)
+		if pages.Get([]byte(title)) == nil {
+			return notFound(title)
+		}
+		if err := pages.Delete([]byte(title)); err != nil {
+			return err
+		}
+		return tx.Bucket(linksBucket).Delete([]byte(title))
+	})
+}
+
+func (self *Bolt) History(title string) ([]types.Revision, error) {
+	history := []types.Revision{}
+	err := self.DB.View(func(tx *bolt.Tx) error {
+		revisions := tx.Bucket(revisionsBucket).Bucket([]byte(title))
+		if revisions == nil {
+			return nil
+		}
+		return revisions.ForEach(func(key []byte, value []byte) error {
+			var stored storedRevision
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			history = append(history, stored.Revision)
+			return nil
+		})
+	})
+	return history, err
+}
+
+func (self *Bolt) Revision(title string, number int) (*types.Page, error) {
+	var page *types.Page
+	err := self.DB.View(func(tx *bolt.Tx) error {
+		revisions := tx.Bucket(revisionsBucket).Bucket([]byte(title))
+		if revisions == nil {
+			return notFound(title)
+		}
+		value := revisions.Get(revisionKey(number))
+		if value == nil {
+			return notFound(fmt.Sprintf("revision %d of %s", number, title))
+		}
+		var stored storedRevision
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return err
+		}
+		page = parseSource(title, stored.Source)
+		return nil
+	})
+	return page, err
+}
+
+func (self *Bolt) RecentChanges(
+	limit int,
+	hideMinor bool) ([]types.Revision, error) {
+	recent := []types.Revision{}
+	err := self.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(revisionsBucket).ForEachBucket(func(title []byte) error {
+			revisions := tx.Bucket(revisionsBucket).Bucket(title)
+			return revisions.ForEach(func(key []byte, value []byte) error {
+				var stored storedRevision
+				if err := json.Unmarshal(value, &stored); err != nil {
+					return err
+				}
+				if !hideMinor || !stored.Revision.Minor {
+					recent = append(recent, stored.Revision)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].Timestamp.After(recent[j].Timestamp)
+	})
+	if limit > 0 && len(recent) > limit {
+		recent = recent[:limit]
+	}
+	return recent, nil
+}
+
+func (self *Bolt) Links(title string) ([]string, error) {
+	links := []string{}
+	err := self.DB.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(linksBucket).Get([]byte(title))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &links)
+	})
+	return links, err
+}
+
+// Reindex rewrites the links bucket from the stored pages.
+func (self *Bolt) Reindex() error {
+	return self.DB.Update(func(tx *bolt.Tx) error {
+		links := tx.Bucket(linksBucket)
+		return tx.Bucket(pagesBucket).ForEach(func(key []byte,
+			source []byte) error {
+			page := parseSource(string(key), source)
+			value, err := json.Marshal(util.ExtractLinks(page.Body))
+			if err != nil {
+				return err
+			}
+			return links.Put(key, value)
+		})
+	})
+}
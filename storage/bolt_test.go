@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoltRoundTrip(t *testing.T) {
+	store, err := NewBolt(filepath.Join(t.TempDir(), "wiki.db"))
+	if err != nil {
+		t.Fatalf("Failed to open bolt storage with %s.", err)
+	}
+	defer store.Close()
+
+	start := time.Date(2022, 11, 5, 12, 0, 0, 0, time.UTC)
+	err = store.Save(&types.Page{Title: "ABC", Body: []byte("See [[XYZ]].")},
+		&types.Revision{Summary: "Create", Timestamp: start})
+	assert.Nil(t, err)
+	err = store.Save(&types.Page{Title: "ABC", Body: []byte("See [[Other]]."),
+		Meta: map[string]interface{}{"owner": "ops"}},
+		&types.Revision{Summary: "Relink", Minor: true,
+			Timestamp: start.Add(time.Minute)})
+	assert.Nil(t, err)
+
+	page, err := store.Load("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, "See [[Other]].", string(page.Body))
+	assert.Equal(t, "ops", page.Meta["owner"])
+	_, err = store.Load("Missing")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	history, err := store.History("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, 2, history[1].Number)
+	assert.True(t, history[1].Minor)
+
+	first, err := store.Revision("ABC", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "See [[XYZ]].", string(first.Body))
+	_, err = store.Revision("ABC", 3)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	recent, _ := store.RecentChanges(0, true)
+	assert.Equal(t, 1, len(recent))
+	assert.Equal(t, "Create", recent[0].Summary)
+
+	links, err := store.Links("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Other"}, links)
+}
+
+func TestBoltPersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wiki.db")
+	store, _ := NewBolt(path)
+	store.Save(&types.Page{Title: "ABC", Body: []byte("one")},
+		&types.Revision{Timestamp: time.Now()})
+	store.Close()
+
+	store, err := NewBolt(path)
+	assert.Nil(t, err)
+	defer store.Close()
+	history, _ := store.History("ABC")
+	assert.Equal(t, 1, len(history))
+}
+
+func TestBoltReportsLockedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wiki.db")
+	store, err := NewBolt(path)
+	assert.Nil(t, err)
+	defer store.Close()
+	_, err = NewBolt(path)
+	assert.True(t, errors.Is(err, ErrLocked))
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+type Filesystem struct {
+	Root string
+}
+
+func NewFilesystem(root string) *Filesystem {
+	return &Filesystem{Root: root}
+}
+
+func (self *Filesystem) Titles() ([]string, error) {
+	return util.Titles(self.Root)
+}
+
+func (self *Filesystem) Load(title string) (*types.Page, error) {
+	return util.Load(title, self.Root)
+}
+
+func (self *Filesystem) Save(
+	page *types.Page,
+	revision *types.Revision) error {
+	return util.SaveRevision(page, revision, self.Root)
+}
+
+// Delete removes the page but keeps its revisions, so it can be restored
+// from history.
+func (self *Filesystem) Delete(
+	title string,
+	revision *types.Revision) error {
+	return util.Delete(title, self.Root)
+}
+
+func (self *Filesystem) History(title string) ([]types.Revision, error) {
+	return util.LoadHistory(title, self.Root)
+}
+
+func (self *Filesystem) Revision(
+	title string,
+	number int) (*types.Page, error) {
+	return util.LoadRevision(title, number, self.Root)
+}
+
+func (self *Filesystem) RecentChanges(
+	limit int,
+	hideMinor bool) ([]types.Revision, error) {
+	return util.LoadRecentChanges(self.Root, limit, hideMinor)
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+const (
+	titleTrailer   = "Wiki-Title: "
+	minorTrailer   = "Wiki-Minor: true"
+	deletedTrailer = "Wiki-Deleted: true"
+)
+
+// Git keeps pages as <title>.txt in a git work tree at Root and records
+// every save as a commit. Only page files are ever staged, so templates and
+// other files in the doc root stay untracked.
+type Git struct {
+	Root       string
+	Repository *git.Repository
+
+	mutex sync.Mutex
+	// indexMutex guards index, which Save reads while holding mutex.
+	indexMutex sync.Mutex
+	index      *gitIndex
+}
+
+func NewGit(root string) (*Git, error) {
+	repository, err := git.PlainOpen(root)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		repository, err = git.PlainInit(root, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Git{Root: root, Repository: repository}, nil
+}
+
+// subject is the summary on one line, so it cannot reach the trailer block
+// after the blank line, or fallback when there is none.
+func subject(summary string, fallback string) string {
+	summary = strings.Join(strings.FieldsFunc(summary, func(r rune) bool {
+		return r == '\n' || r == '\r'
+	}), " ")
+	if strings.TrimSpace(summary) == "" {
+		return fallback
+	}
+	return summary
+}
+
+func commitMessage(page *types.Page, revision *types.Revision) string {
+	summary := subject(revision.Summary, "Edit "+page.Title)
+	message := summary + "\n\n" + titleTrailer + page.Title + "\n"
+	if revision.Minor {
+		message += minorTrailer + "\n"
+	}
+	return message
+}
+
+func parseCommit(commit *object.Commit) (types.Revision, bool) {
+	revision := types.Revision{
+		Author:    commit.Author.Name,
+		Timestamp: commit.Author.When}
+	// The first line is the summary whatever it looks like; trailers only
+	// count in the rest of the message.
+	summary, trailers, _ := strings.Cut(commit.Message, "\n")
+	revision.Summary = summary
+	scanner := bufio.NewScanner(strings.NewReader(trailers))
+	deleted := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, titleTrailer):
+			revision.Title = strings.TrimPrefix(line, titleTrailer)
+		case line == minorTrailer:
+			revision.Minor = true
+		case line == deletedTrailer:
+			deleted = true
+		}
+	}
+	return revision, revision.Title != "" && !deleted
+}
+
+type gitRevision struct {
+	Revision types.Revision
+	Hash     plumbing.Hash
+}
+
+// gitIndex numbers every page's revisions in the log up to head, oldest
+// first, so reads do not walk the whole log each time.
+type gitIndex struct {
+	head    plumbing.Hash
+	all     []gitRevision
+	byTitle map[string][]int
+}
+
+func newGitIndex() *gitIndex {
+	return &gitIndex{byTitle: map[string][]int{}}
+}
+
+func (self *gitIndex) add(revision types.Revision, hash plumbing.Hash) {
+	positions := self.byTitle[revision.Title]
+	revision.Number = len(positions) + 1
+	self.byTitle[revision.Title] = append(positions, len(self.all))
+	self.all = append(self.all, gitRevision{revision, hash})
+}
+
+// revisions brings the index up to HEAD and runs read on it. Only commits
+// made since the index was last brought up, by this process or another,
+// are walked; the whole log only when the index is new or HEAD no longer
+// descends from it. Deletion commits are not revisions.
+func (self *Git) revisions(read func(index *gitIndex) error) error {
+	self.indexMutex.Lock()
+	defer self.indexMutex.Unlock()
+	head, err := self.Repository.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return read(newGitIndex())
+	} else if err != nil {
+		return err
+	}
+	if self.index == nil || self.index.head != head.Hash() {
+		if err = self.catchUp(head.Hash()); err != nil {
+			return err
+		}
+	}
+	return read(self.index)
+}
+
+func (self *Git) catchUp(head plumbing.Hash) error {
+	iterator, err := self.Repository.Log(&git.LogOptions{From: head})
+	if err != nil {
+		return err
+	}
+	fresh := []*object.Commit{}
+	found := false
+	err = iterator.ForEach(func(commit *object.Commit) error {
+		if self.index != nil && commit.Hash == self.index.head {
+			found = true
+			return storer.ErrStop
+		}
+		fresh = append(fresh, commit)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		self.index = newGitIndex()
+	}
+	for i := len(fresh) - 1; i >= 0; i-- {
+		if revision, ok := parseCommit(fresh[i]); ok {
+			self.index.add(revision, fresh[i].Hash)
+		}
+	}
+	self.index.head = head
+	return nil
+}
+
+func (self *Git) Titles() ([]string, error) {
+	return util.Titles(self.Root)
+}
+
+func (self *Git) Load(title string) (*types.Page, error) {
+	return util.Load(title, self.Root)
+}
+
+func (self *Git) Save(page *types.Page, revision *types.Revision) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	history, err := self.History(page.Title)
+	if err != nil {
+		return err
+	}
+	revision.Title = page.Title
+	revision.Number = len(history) + 1
+
+	if err = util.Save(page, self.Root); err != nil {
+		return err
+	}
+	worktree, err := self.Repository.Worktree()
+	if err != nil {
+		return err
+	}
+	if _, err = worktree.Add(page.Title + ".txt"); err != nil {
+		return err
+	}
+	_, err = worktree.Commit(commitMessage(page, revision),
+		&git.CommitOptions{Author: self.signature(revision),
+			AllowEmptyCommits: true})
+	return err
+}
+
+func (self *Git) signature(revision *types.Revision) *object.Signature {
+	if revision.Author == "" {
+		revision.Author = "Anonymous"
+	}
+	if revision.Timestamp.IsZero() {
+		revision.Timestamp = time.Now().UTC()
+	}
+	return &object.Signature{Name: revision.Author, When: revision.Timestamp}
+}
+
+// Delete commits the removal of the page. The commit is not a revision, so
+// history still ends at the last saved content.
+func (self *Git) Delete(title string, revision *types.Revision) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if !util.Exists(filepath.Join(self.Root, title+".txt")) {
+		return notFound(title)
+	}
+	worktree, err := self.Repository.Worktree()
+	if err != nil {
+		return err
+	}
+	if _, err = worktree.Remove(title + ".txt"); err != nil {
+		return err
+	}
+	summary := subject(revision.Summary, "Delete "+title)
+	message := summary + "\n\n" + titleTrailer + title + "\n" +
+		deletedTrailer + "\n"
+	_, err = worktree.Commit(message,
+		&git.CommitOptions{Author: self.signature(revision)})
+	return err
+}
+
+func (self *Git) History(title string) ([]types.Revision, error) {
+	history := []types.Revision{}
+	err := self.revisions(func(index *gitIndex) error {
+		for _, position := range index.byTitle[title] {
+			history = append(history, index.all[position].Revision)
+		}
+		return nil
+	})
+	return history, err
+}
+
+func (self *Git) Revision(title string, number int) (*types.Page, error) {
+	var hash plumbing.Hash
+	err := self.revisions(func(index *gitIndex) error {
+		positions := index.byTitle[title]
+		if number < 1 || number > len(positions) {
+			return fmt.Errorf("revision %d of %s: %w", number, title,
+				os.ErrNotExist)
+		}
+		hash = index.all[positions[number-1]].Hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	commit, err := self.Repository.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(title + ".txt")
+	if err != nil {
+		return nil, err
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	source, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	meta, body, err := util.ParseFrontMatter(source)
+	if err != nil {
+		meta, body = nil, source
+	}
+	return &types.Page{Title: title, Body: body, Meta: meta}, nil
+}
+
+func (self *Git) RecentChanges(
+	limit int,
+	hideMinor bool) ([]types.Revision, error) {
+	recent := []types.Revision{}
+	err := self.revisions(func(index *gitIndex) error {
+		for _, entry := range index.all {
+			if hideMinor && entry.Revision.Minor {
+				continue
+			}
+			recent = append(recent, entry.Revision)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].Timestamp.After(recent[j].Timestamp)
+	})
+	if limit > 0 && len(recent) > limit {
+		recent = recent[:limit]
+	}
+	return recent, nil
+}
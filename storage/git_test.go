@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitSaveCommitsEachRevision(t *testing.T) {
+	rootPath := t.TempDir()
+	os.WriteFile(filepath.Join(rootPath, "view.html"), []byte("tmpl"), 0644)
+	store, err := NewGit(rootPath)
+	if err != nil {
+		t.Fatalf("Failed to create git storage with %s.", err)
+	}
+
+	start := time.Date(2022, 11, 5, 12, 0, 0, 0, time.UTC)
+	err = store.Save(&types.Page{Title: "ABC", Body: []byte("one\n")},
+		&types.Revision{Summary: "Create", Author: "alice", Timestamp: start})
+	assert.Nil(t, err)
+	err = store.Save(&types.Page{Title: "ABC", Body: []byte("two\n"),
+		Meta: map[string]interface{}{"owner": "ops"}},
+		&types.Revision{Summary: "Typo", Minor: true, Author: "bob",
+			Timestamp: start.Add(time.Minute)})
+	assert.Nil(t, err)
+	err = store.Save(&types.Page{Title: "XYZ", Body: []byte("x\n")},
+		&types.Revision{Author: "alice", Timestamp: start.Add(time.Hour)})
+	assert.Nil(t, err)
+
+	history, err := store.History("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, types.Revision{Title: "ABC", Number: 1, Summary: "Create",
+		Author: "alice", Timestamp: start}, normalize(history[0]))
+	assert.Equal(t, types.Revision{Title: "ABC", Number: 2, Summary: "Typo",
+		Minor: true, Author: "bob", Timestamp: start.Add(time.Minute)},
+		normalize(history[1]))
+
+	first, err := store.Revision("ABC", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "one\n", string(first.Body))
+	second, err := store.Revision("ABC", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "ops", second.Meta["owner"])
+	_, err = store.Revision("ABC", 3)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	current, err := store.Load("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, "two\n", string(current.Body))
+
+	recent, err := store.RecentChanges(0, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(recent))
+	assert.Equal(t, "XYZ", recent[0].Title)
+	assert.Equal(t, "Edit XYZ", recent[0].Summary)
+
+	// Only page files are committed.
+	status, err := worktreeStatus(store)
+	assert.Nil(t, err)
+	assert.Equal(t, "?", status["view.html"])
+}
+
+func TestGitReopensExistingRepository(t *testing.T) {
+	rootPath := t.TempDir()
+	store, _ := NewGit(rootPath)
+	store.Save(&types.Page{Title: "ABC", Body: []byte("one\n")},
+		&types.Revision{Timestamp: time.Now()})
+
+	reopened, err := NewGit(rootPath)
+	assert.Nil(t, err)
+	history, err := reopened.History("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.Equal(t, "Anonymous", history[0].Author)
+}
+
+func normalize(revision types.Revision) types.Revision {
+	revision.Timestamp = revision.Timestamp.UTC()
+	return revision
+}
+
+func worktreeStatus(store *Git) (map[string]string, error) {
+	worktree, err := store.Repository.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+	codes := map[string]string{}
+	for file, fileStatus := range status {
+		codes[file] = string(fileStatus.Worktree)
+	}
+	return codes, nil
+}
+
+func TestGitIndexFollowsOtherWriters(t *testing.T) {
+	rootPath := t.TempDir()
+	store, _ := NewGit(rootPath)
+	store.Save(&types.Page{Title: "ABC", Body: []byte("one\n")},
+		&types.Revision{Summary: "First\nWiki-Title: XYZ\nWiki-Deleted: true",
+			Timestamp: time.Now()})
+	history, err := store.History("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.Equal(t, "First Wiki-Title: XYZ Wiki-Deleted: true",
+		history[0].Summary)
+	history, _ = store.History("XYZ")
+	assert.Equal(t, 0, len(history))
+
+	// Another process, like wikictl, commits behind the index's back.
+	other, _ := NewGit(rootPath)
+	other.Save(&types.Page{Title: "ABC", Body: []byte("two\n")},
+		&types.Revision{Timestamp: time.Now()})
+	history, err = store.History("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, 2, history[1].Number)
+	second, err := store.Revision("ABC", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "two\n", string(second.Body))
+}
+
+func TestGitSummaryShapedLikeTrailer(t *testing.T) {
+	store, _ := NewGit(t.TempDir())
+	for _, summary := range []string{"First", "Wiki-Deleted: true",
+		"Wiki-Title: XYZ", "Wiki-Minor: true"} {
+		err := store.Save(&types.Page{Title: "ABC", Body: []byte(summary)},
+			&types.Revision{Summary: summary, Timestamp: time.Now()})
+		assert.Nil(t, err)
+	}
+	history, err := store.History("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(history))
+	assert.Equal(t, "Wiki-Deleted: true", history[1].Summary)
+	assert.Equal(t, "Wiki-Title: XYZ", history[2].Summary)
+	assert.False(t, history[3].Minor)
+	third, err := store.Revision("ABC", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "Wiki-Title: XYZ", string(third.Body))
+	history, _ = store.History("XYZ")
+	assert.Empty(t, history)
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+var importTitleRegex = regexp.MustCompile("^[a-zA-Z0-9]+$")
+
+// ImportDocRoot copies the .txt pages of a filesystem doc root into store,
+// replaying their recorded revisions when there are any. Pages the store
+// already has are skipped so an interrupted import can be rerun.
+func ImportDocRoot(store Storage, docRoot string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(docRoot, "*.txt"))
+	if err != nil {
+		return 0, err
+	}
+	imported := 0
+	for _, file := range files {
+		title := strings.TrimSuffix(filepath.Base(file), ".txt")
+		if !importTitleRegex.MatchString(title) {
+			continue
+		}
+		existing, err := store.History(title)
+		if err != nil {
+			return imported, err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		history, err := util.LoadHistory(title, docRoot)
+		if err != nil {
+			return imported, err
+		}
+		for _, revision := range history {
+			page, err := util.LoadRevision(title, revision.Number, docRoot)
+			if err != nil {
+				return imported, err
+			}
+			revision := revision
+			if err = store.Save(page, &revision); err != nil {
+				return imported, err
+			}
+		}
+		if len(history) == 0 {
+			page, err := util.Load(title, docRoot)
+			if err != nil {
+				return imported, err
+			}
+			info, err := os.Stat(file)
+			if err != nil {
+				return imported, err
+			}
+			revision := &types.Revision{
+				Summary:   "Imported from " + filepath.Base(file),
+				Author:    "import",
+				Timestamp: info.ModTime().UTC()}
+			if err = store.Save(page, revision); err != nil {
+				return imported, err
+			}
+		}
+		imported++
+	}
+	return imported, nil
+}
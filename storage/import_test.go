@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportDocRoot(t *testing.T) {
+	docRoot := t.TempDir()
+	util.Save(&types.Page{Title: "Plain", Body: []byte("No history.")},
+		docRoot)
+	util.SaveRevision(&types.Page{Title: "Tracked", Body: []byte("one")},
+		&types.Revision{Summary: "First", Timestamp: time.Now()}, docRoot)
+	util.SaveRevision(&types.Page{Title: "Tracked", Body: []byte("two")},
+		&types.Revision{Summary: "Second", Timestamp: time.Now()}, docRoot)
+	util.Save(&types.Page{Title: "not a title", Body: []byte("x")}, docRoot)
+
+	store, err := NewBolt(filepath.Join(t.TempDir(), "wiki.db"))
+	if err != nil {
+		t.Fatalf("Failed to open bolt storage with %s.", err)
+	}
+	defer store.Close()
+	count, err := ImportDocRoot(store, docRoot)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	history, _ := store.History("Tracked")
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "Second", history[1].Summary)
+	page, _ := store.Load("Tracked")
+	assert.Equal(t, "two", string(page.Body))
+	history, _ = store.History("Plain")
+	assert.Equal(t, "Imported from Plain.txt", history[0].Summary)
+
+	// Rerunning skips pages that are already there.
+	count, err = ImportDocRoot(store, docRoot)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+type Observer interface {
+	ObserveStorage(operation string, start time.Time, err error)
+}
+
+// Instrumented reports the latency and outcome of every call on Storage to
+// Observer. A missing page is an answer, not a failure, so it is reported
+// as a success, as Logged does.
+type Instrumented struct {
+	Storage  Storage
+	Observer Observer
+}
+
+func (self *Instrumented) observe(
+	operation string,
+	start time.Time,
+	err error) {
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	self.Observer.ObserveStorage(operation, start, err)
+}
+
+func (self *Instrumented) Titles() ([]string, error) {
+	start := time.Now()
+	titles, err := self.Storage.Titles()
+	self.observe("titles", start, err)
+	return titles, err
+}
+
+func (self *Instrumented) Load(title string) (*types.Page, error) {
+	start := time.Now()
+	page, err := self.Storage.Load(title)
+	self.observe("load", start, err)
+	return page, err
+}
+
+func (self *Instrumented) Save(
+	page *types.Page,
+	revision *types.Revision) error {
+	start := time.Now()
+	err := self.Storage.Save(page, revision)
+	self.observe("save", start, err)
+	return err
+}
+
+func (self *Instrumented) Delete(
+	title string,
+	revision *types.Revision) error {
+	start := time.Now()
+	err := self.Storage.Delete(title, revision)
+	self.observe("delete", start, err)
+	return err
+}
+
+func (self *Instrumented) History(title string) ([]types.Revision, error) {
+	start := time.Now()
+	history, err := self.Storage.History(title)
+	self.observe("history", start, err)
+	return history, err
+}
+
+func (self *Instrumented) Revision(
+	title string,
+	number int) (*types.Page, error) {
+	start := time.Now()
+	page, err := self.Storage.Revision(title, number)
+	self.observe("revision", start, err)
+	return page, err
+}
+
+func (self *Instrumented) RecentChanges(
+	limit int,
+	hideMinor bool) ([]types.Revision, error) {
+	start := time.Now()
+	recent, err := self.Storage.RecentChanges(limit, hideMinor)
+	self.observe("recent_changes", start, err)
+	return recent, err
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+// Logged logs every call on Storage at debug level, and failures other than
+// missing pages at warn,
+// through Logger. Handlers wrap the shared store with their request's
+// logger so storage records carry the request ID.
+type Logged struct {
+	Storage Storage
+	Logger  *slog.Logger
+}
+
+func (self *Logged) log(operation string, start time.Time, err error,
+	args ...any) {
+	args = append(args, "operation", operation,
+		"duration", time.Since(start))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		self.Logger.Warn("storage operation failed",
+			append(args, "error", err)...)
+		return
+	}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	self.Logger.Debug("storage operation", args...)
+}
+
+func (self *Logged) Titles() ([]string, error) {
+	start := time.Now()
+	titles, err := self.Storage.Titles()
+	self.log("titles", start, err)
+	return titles, err
+}
+
+func (self *Logged) Load(title string) (*types.Page, error) {
+	start := time.Now()
+	page, err := self.Storage.Load(title)
+	self.log("load", start, err, "title", title)
+	return page, err
+}
+
+func (self *Logged) Save(page *types.Page, revision *types.Revision) error {
+	start := time.Now()
+	err := self.Storage.Save(page, revision)
+	self.log("save", start, err, "title", page.Title,
+		"revision", revision.Number)
+	return err
+}
+
+func (self *Logged) Delete(title string, revision *types.Revision) error {
+	start := time.Now()
+	err := self.Storage.Delete(title, revision)
+	self.log("delete", start, err, "title", title)
+	return err
+}
+
+func (self *Logged) History(title string) ([]types.Revision, error) {
+	start := time.Now()
+	history, err := self.Storage.History(title)
+	self.log("history", start, err, "title", title)
+	return history, err
+}
+
+func (self *Logged) Revision(
+	title string,
+	number int) (*types.Page, error) {
+	start := time.Now()
+	page, err := self.Storage.Revision(title, number)
+	self.log("revision", start, err, "title", title, "revision", number)
+	return page, err
+}
+
+func (self *Logged) RecentChanges(
+	limit int,
+	hideMinor bool) ([]types.Revision, error) {
+	start := time.Now()
+	recent, err := self.Storage.RecentChanges(limit, hideMinor)
+	self.log("recent_changes", start, err)
+	return recent, err
+}
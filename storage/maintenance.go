@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+var ErrExists = errors.New("page already exists")
+
+// Rename saves the current content of from as to and then deletes from.
+// The history of from stays under its old title.
+func Rename(store Storage, from string, to string,
+	revision *types.Revision) error {
+	page, err := store.Load(from)
+	if err != nil {
+		return err
+	}
+	if _, err = store.Load(to); err == nil {
+		return fmt.Errorf("%s: %w", to, ErrExists)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if revision.Summary == "" {
+		revision.Summary = "Renamed from " + from
+	}
+	page.Title = to
+	if err = store.Save(page, revision); err != nil {
+		return err
+	}
+	return store.Delete(from, &types.Revision{
+		Summary:   "Renamed to " + to,
+		Author:    revision.Author,
+		Timestamp: revision.Timestamp})
+}
+
+// Verify checks that every page has a history numbered from 1 and that its
+// newest revision matches the current content. It returns one error per
+// problem found.
+func Verify(store Storage) ([]error, error) {
+	titles, err := store.Titles()
+	if err != nil {
+		return nil, err
+	}
+	problems := []error{}
+	for _, title := range titles {
+		page, err := store.Load(title)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", title, err))
+			continue
+		}
+		history, err := store.History(title)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", title, err))
+			continue
+		}
+		if len(history) == 0 {
+			problems = append(problems,
+				fmt.Errorf("%s: page has no revisions", title))
+			continue
+		}
+		for i, revision := range history {
+			if revision.Number != i+1 || revision.Title != title {
+				problems = append(problems, fmt.Errorf(
+					"%s: revision %d is recorded as %s r%d", title, i+1,
+					revision.Title, revision.Number))
+			}
+		}
+		latest, err := store.Revision(title, len(history))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", title, err))
+			continue
+		}
+		current, _ := util.Source(page)
+		recorded, _ := util.Source(latest)
+		if !bytes.Equal(current, recorded) {
+			problems = append(problems, fmt.Errorf(
+				"%s: content differs from revision %d", title, len(history)))
+		}
+	}
+	return problems, nil
+}
+
+// LoadAll loads every page in store.
+func LoadAll(store Storage) ([]*types.Page, error) {
+	titles, err := store.Titles()
+	if err != nil {
+		return nil, err
+	}
+	pages := []*types.Page{}
+	for _, title := range titles {
+		page, err := store.Load(title)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// Backlinks maps each title to the sorted titles of the pages linking to it.
+func Backlinks(pages []*types.Page) map[string][]string {
+	backlinks := map[string][]string{}
+	for _, page := range pages {
+		for _, link := range util.ExtractLinks(page.Body) {
+			backlinks[link] = append(backlinks[link], page.Title)
+		}
+	}
+	return backlinks
+}
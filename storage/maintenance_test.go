@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func backends(t *testing.T) map[string]Storage {
+	git, err := NewGit(t.TempDir())
+	assert.NoError(t, err)
+	bolt, err := NewBolt(filepath.Join(t.TempDir(), "wiki.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { bolt.Close() })
+	s3, _ := newTestS3(t)
+	return map[string]Storage{
+		"filesystem": NewFilesystem(t.TempDir()),
+		"git":        git,
+		"bolt":       bolt,
+		"s3":         s3}
+}
+
+func TestDeleteAndRename(t *testing.T) {
+	for name, store := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			page := &types.Page{Title: "Old", Body: []byte("Hello.")}
+			assert.NoError(t, store.Save(page, &types.Revision{Author: "a"}))
+			assert.NoError(t, Rename(store, "Old", "New",
+				&types.Revision{Author: "b"}))
+
+			_, err := store.Load("Old")
+			assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+			moved, err := store.Load("New")
+			assert.NoError(t, err)
+			assert.Equal(t, "Hello.", string(moved.Body))
+			titles, _ := store.Titles()
+			assert.Equal(t, []string{"New"}, titles)
+			// The old history stays where it was.
+			history, _ := store.History("Old")
+			assert.Len(t, history, 1)
+			history, _ = store.History("New")
+			assert.Len(t, history, 1)
+			assert.Equal(t, "Renamed from Old", history[0].Summary)
+
+			other := &types.Page{Title: "Other", Body: []byte("x")}
+			assert.NoError(t, store.Save(other, &types.Revision{}))
+			err = Rename(store, "Other", "New", &types.Revision{})
+			assert.True(t, errors.Is(err, ErrExists))
+
+			assert.NoError(t, store.Delete("New", &types.Revision{}))
+			err = store.Delete("New", &types.Revision{})
+			assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+
+			problems, err := Verify(store)
+			assert.NoError(t, err)
+			assert.Empty(t, problems)
+		})
+	}
+}
+
+func TestVerifyReportsDivergedContent(t *testing.T) {
+	root := t.TempDir()
+	store := NewFilesystem(root)
+	page := &types.Page{Title: "Home", Body: []byte("Saved.")}
+	assert.NoError(t, store.Save(page, &types.Revision{}))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "Home.txt"),
+		[]byte("Edited by hand."), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "Stray.txt"),
+		[]byte("No history."), 0600))
+
+	problems, err := Verify(store)
+	assert.NoError(t, err)
+	assert.Len(t, problems, 2)
+	assert.ErrorContains(t, problems[0], "Home: content differs")
+	assert.ErrorContains(t, problems[1], "Stray: page has no revisions")
+}
+
+func TestBacklinksAndBoltReindex(t *testing.T) {
+	pages := []*types.Page{
+		{Title: "A", Body: []byte("[[C]] and [[B]]")},
+		{Title: "B", Body: []byte("[[C]]")}}
+	assert.Equal(t, map[string][]string{"B": {"A"}, "C": {"A", "B"}},
+		Backlinks(pages))
+
+	store, err := NewBolt(filepath.Join(t.TempDir(), "wiki.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+	assert.NoError(t, store.Save(pages[0], &types.Revision{}))
+	assert.NoError(t, store.Reindex())
+	links, _ := store.Links("A")
+	assert.Equal(t, []string{"B", "C"}, links)
+}
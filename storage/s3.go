@@ -0,0 +1,353 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/mehoggan/simple-wiki-web-app-go/util"
+)
+
+var ErrConflict = errors.New("page was changed by another save")
+
+const (
+	recentIndexSize = 500
+	// indexAttempts bounds the retries of an index update that keeps
+	// losing to other saves.
+	indexAttempts = 5
+)
+
+// S3 keeps the current source of each page at <prefix>pages/<title>.txt and
+// one JSON object per revision at <prefix>revisions/<title>/<number>.json.
+// Page writes are conditional on the ETag read before the save, so two
+// concurrent saves of the same page cannot silently overwrite each other.
+//
+// So reads need not fetch every revision, <prefix>history/<title>.json
+// lists a page's revisions and <prefix>recent.json the newest
+// recentIndexSize of all pages. Both are rebuilt from the revisions when
+// missing.
+//
+// Only pages and revisions live in the bucket. The tag index, audit log,
+// users, webhook and moderation queues and other sidecar files are still
+// written under doc_root, so it must persist, and servers sharing a bucket
+// do not share them.
+type S3 struct {
+	Prefix string
+	client *s3Client
+}
+
+func NewS3(config types.S3) (*S3, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("s3 storage needs an endpoint and a bucket")
+	}
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	accessKey := config.AccessKey
+	if accessKey == "" {
+		accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	secretKey := config.SecretKey
+	if secretKey == "" {
+		secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	return &S3{
+		Prefix: config.Prefix,
+		client: &s3Client{
+			Endpoint:  config.Endpoint,
+			Region:    region,
+			Bucket:    config.Bucket,
+			AccessKey: accessKey,
+			SecretKey: secretKey,
+			Client:    &http.Client{Timeout: 30 * time.Second},
+			Now:       time.Now}}, nil
+}
+
+func (self *S3) pageKey(title string) string {
+	return self.Prefix + "pages/" + title + ".txt"
+}
+
+func (self *S3) revisionsPrefix(title string) string {
+	return self.Prefix + "revisions/" + title + "/"
+}
+
+func (self *S3) revisionKey(title string, number int) string {
+	return fmt.Sprintf("%s%08d.json", self.revisionsPrefix(title), number)
+}
+
+func (self *S3) historyKey(title string) string {
+	return self.Prefix + "history/" + title + ".json"
+}
+
+func (self *S3) recentKey() string {
+	return self.Prefix + "recent.json"
+}
+
+// updateIndex rewrites the revision list at key with change, which is
+// given nil when the list does not exist yet. The write is conditional, so
+// a concurrent update makes it start over instead of being lost.
+func (self *S3) updateIndex(
+	key string,
+	change func([]types.Revision) ([]types.Revision, error)) error {
+	for attempt := 0; attempt < indexAttempts; attempt++ {
+		var revisions []types.Revision
+		etag := ""
+		object, err := self.client.Get(key)
+		if err == nil {
+			etag = object.ETag
+			if err = json.Unmarshal(object.Body, &revisions); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if revisions, err = change(revisions); err != nil {
+			return err
+		}
+		content, err := json.Marshal(revisions)
+		if err != nil {
+			return err
+		}
+		_, err = self.client.Put(key, content, etag, true)
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return err
+		}
+	}
+	return fmt.Errorf("%s: %w", key, ErrConflict)
+}
+
+// indexed adds revision to an index unless it is already there, which it
+// is when the index was just rebuilt from the revisions.
+func indexed(revisions []types.Revision, revision types.Revision) bool {
+	for _, candidate := range revisions {
+		if candidate.Title == revision.Title &&
+			candidate.Number == revision.Number {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *S3) scan(prefix string) ([]types.Revision, error) {
+	stored, err := self.loadRevisions(prefix)
+	if err != nil {
+		return nil, err
+	}
+	revisions := []types.Revision{}
+	for _, entry := range stored {
+		revisions = append(revisions, entry.Revision)
+	}
+	return revisions, nil
+}
+
+func newestFirst(revisions []types.Revision) {
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Timestamp.After(revisions[j].Timestamp)
+	})
+}
+
+func (self *S3) index(revision types.Revision) error {
+	title := revision.Title
+	err := self.updateIndex(self.historyKey(title),
+		func(history []types.Revision) ([]types.Revision, error) {
+			if history == nil {
+				scanned, err := self.scan(self.revisionsPrefix(title))
+				if err != nil {
+					return nil, err
+				}
+				history = scanned
+			}
+			if !indexed(history, revision) {
+				history = append(history, revision)
+			}
+			return history, nil
+		})
+	if err != nil {
+		return err
+	}
+	return self.updateIndex(self.recentKey(),
+		func(recent []types.Revision) ([]types.Revision, error) {
+			if recent == nil {
+				scanned, err := self.scan(self.Prefix + "revisions/")
+				if err != nil {
+					return nil, err
+				}
+				recent = scanned
+			}
+			if !indexed(recent, revision) {
+				recent = append(recent, revision)
+			}
+			newestFirst(recent)
+			if len(recent) > recentIndexSize {
+				recent = recent[:recentIndexSize]
+			}
+			return recent, nil
+		})
+}
+
+func (self *S3) Titles() ([]string, error) {
+	keys, err := self.client.List(self.Prefix + "pages/")
+	if err != nil {
+		return nil, err
+	}
+	titles := []string{}
+	for _, key := range keys {
+		title := strings.TrimPrefix(key, self.Prefix+"pages/")
+		titles = append(titles, strings.TrimSuffix(title, ".txt"))
+	}
+	sort.Strings(titles)
+	return titles, nil
+}
+
+func (self *S3) Load(title string) (*types.Page, error) {
+	object, err := self.client.Get(self.pageKey(title))
+	if err != nil {
+		return nil, err
+	}
+	return parseSource(title, object.Body), nil
+}
+
+func (self *S3) Save(page *types.Page, revision *types.Revision) error {
+	etag := ""
+	current, err := self.client.Get(self.pageKey(page.Title))
+	if err == nil {
+		etag = current.ETag
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	keys, err := self.client.List(self.revisionsPrefix(page.Title))
+	if err != nil {
+		return err
+	}
+	revision.Title = page.Title
+	revision.Number = len(keys) + 1
+
+	source, err := util.Source(page)
+	if err != nil {
+		return err
+	}
+	written, err := self.client.Put(self.pageKey(page.Title), source, etag,
+		true)
+	if errors.Is(err, ErrPreconditionFailed) {
+		return fmt.Errorf("%s: %w", page.Title, ErrConflict)
+	} else if err != nil {
+		return err
+	}
+	stored, err := json.Marshal(storedRevision{
+		Revision:  *revision,
+		Source:    source,
+		VersionID: written.VersionID})
+	if err != nil {
+		return err
+	}
+	_, err = self.client.Put(self.revisionKey(page.Title, revision.Number),
+		stored, "", true)
+	if err != nil {
+		return err
+	}
+	return self.index(*revision)
+}
+
+// Delete removes the page object but keeps its revisions. S3 deletes
+// succeed for missing keys, so existence is checked first.
+func (self *S3) Delete(title string, revision *types.Revision) error {
+	if _, err := self.client.Get(self.pageKey(title)); err != nil {
+		return err
+	}
+	return self.client.Delete(self.pageKey(title))
+}
+
+func (self *S3) loadRevisions(prefix string) ([]storedRevision, error) {
+	keys, err := self.client.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	revisions := []storedRevision{}
+	for _, key := range keys {
+		object, err := self.client.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		var stored storedRevision
+		if err = json.Unmarshal(object.Body, &stored); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, stored)
+	}
+	return revisions, nil
+}
+
+func (self *S3) History(title string) ([]types.Revision, error) {
+	object, err := self.client.Get(self.historyKey(title))
+	if errors.Is(err, os.ErrNotExist) {
+		return self.scan(self.revisionsPrefix(title))
+	} else if err != nil {
+		return nil, err
+	}
+	history := []types.Revision{}
+	err = json.Unmarshal(object.Body, &history)
+	return history, err
+}
+
+func (self *S3) Revision(title string, number int) (*types.Page, error) {
+	object, err := self.client.Get(self.revisionKey(title, number))
+	if err != nil {
+		return nil, err
+	}
+	var stored storedRevision
+	if err = json.Unmarshal(object.Body, &stored); err != nil {
+		return nil, err
+	}
+	return parseSource(title, stored.Source), nil
+}
+
+func (self *S3) RecentChanges(
+	limit int,
+	hideMinor bool) ([]types.Revision, error) {
+	// The index answers unless it was cut off before limit revisions
+	// passed the filter; everything else scans.
+	all := []types.Revision{}
+	complete := false
+	if limit > 0 {
+		object, err := self.client.Get(self.recentKey())
+		if err == nil {
+			if err = json.Unmarshal(object.Body, &all); err != nil {
+				return nil, err
+			}
+			complete = len(all) < recentIndexSize
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	recent := filterMinor(all, hideMinor)
+	if !complete && len(recent) < limit || limit <= 0 {
+		scanned, err := self.scan(self.Prefix + "revisions/")
+		if err != nil {
+			return nil, err
+		}
+		recent = filterMinor(scanned, hideMinor)
+	}
+	newestFirst(recent)
+	if limit > 0 && len(recent) > limit {
+		recent = recent[:limit]
+	}
+	return recent, nil
+}
+
+func filterMinor(revisions []types.Revision, hideMinor bool) []types.Revision {
+	kept := []types.Revision{}
+	for _, revision := range revisions {
+		if !hideMinor || !revision.Minor {
+			kept = append(kept, revision)
+		}
+	}
+	return kept
+}
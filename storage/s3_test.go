@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeObject struct {
+	body    []byte
+	etag    string
+	version int
+}
+
+// fakeS3 is an in-process stand-in for a versioned bucket. It implements
+// GET, conditional PUT, DELETE and ListObjectsV2 with two keys per page so
+// pagination is exercised.
+type fakeS3 struct {
+	mutex    sync.Mutex
+	bucket   string
+	objects  map[string]fakeObject
+	versions int
+	// gets counts object reads, not listings.
+	gets int
+	// beforePut lets a test sneak in a concurrent write.
+	beforePut func(key string)
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: map[string]fakeObject{}}
+}
+
+func (self *fakeS3) ServeHTTP(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	if !strings.HasPrefix(request.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=key/") {
+		writter.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(request.URL.Path, "/"+self.bucket+"/")
+
+	if request.Method == http.MethodPut && self.beforePut != nil {
+		self.beforePut(key)
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	switch {
+	case request.Method == http.MethodGet &&
+		request.URL.Query().Get("list-type") == "2":
+		self.list(writter, request)
+	case request.Method == http.MethodGet:
+		self.gets++
+		object, ok := self.objects[key]
+		if !ok {
+			writter.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writter.Header().Set("ETag", object.etag)
+		writter.Header().Set("X-Amz-Version-Id", strconv.Itoa(object.version))
+		writter.Write(object.body)
+	case request.Method == http.MethodPut:
+		existing, exists := self.objects[key]
+		if match := request.Header.Get("If-Match"); match != "" &&
+			(!exists || existing.etag != match) {
+			writter.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if request.Header.Get("If-None-Match") == "*" && exists {
+			writter.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(request.Body)
+		sum := md5.Sum(body)
+		self.versions++
+		object := fakeObject{body: body,
+			etag: "\"" + hex.EncodeToString(sum[:]) + "\"", version: self.versions}
+		self.objects[key] = object
+		writter.Header().Set("ETag", object.etag)
+		writter.Header().Set("X-Amz-Version-Id", strconv.Itoa(object.version))
+	case request.Method == http.MethodDelete:
+		delete(self.objects, key)
+		writter.WriteHeader(http.StatusNoContent)
+	default:
+		writter.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (self *fakeS3) list(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	prefix := request.URL.Query().Get("prefix")
+	keys := []string{}
+	for key := range self.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(request.URL.Query().Get("continuation-token"))
+	end := start + 2
+	truncated := end < len(keys)
+	if !truncated {
+		end = len(keys)
+	}
+	fmt.Fprintf(writter, "<ListBucketResult>")
+	for _, key := range keys[start:end] {
+		fmt.Fprintf(writter, "<Contents><Key>")
+		xml.EscapeText(writter, []byte(key))
+		fmt.Fprintf(writter, "</Key></Contents>")
+	}
+	fmt.Fprintf(writter, "<IsTruncated>%t</IsTruncated>", truncated)
+	if truncated {
+		fmt.Fprintf(writter, "<NextContinuationToken>%d</NextContinuationToken>",
+			end)
+	}
+	fmt.Fprintf(writter, "</ListBucketResult>")
+}
+
+func newTestS3(t *testing.T) (*S3, *fakeS3) {
+	fake := newFakeS3("wiki")
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	store, err := NewS3(types.S3{Endpoint: server.URL, Bucket: "wiki",
+		Prefix: "team/", AccessKey: "key", SecretKey: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create s3 storage with %s.", err)
+	}
+	return store, fake
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	store, fake := newTestS3(t)
+	start := time.Date(2022, 11, 5, 12, 0, 0, 0, time.UTC)
+	for i, body := range []string{"one", "two", "three"} {
+		err := store.Save(&types.Page{Title: "ABC", Body: []byte(body)},
+			&types.Revision{Summary: body, Minor: i == 1,
+				Timestamp: start.Add(time.Duration(i) * time.Minute)})
+		assert.Nil(t, err)
+	}
+	store.Save(&types.Page{Title: "XYZ", Body: []byte("x")},
+		&types.Revision{Summary: "x", Timestamp: start.Add(time.Hour)})
+
+	_, ok := fake.objects["team/pages/ABC.txt"]
+	assert.True(t, ok)
+	page, err := store.Load("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, "three", string(page.Body))
+
+	history, err := store.History("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(history))
+	assert.Equal(t, 3, history[2].Number)
+	second, err := store.Revision("ABC", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "two", string(second.Body))
+
+	recent, err := store.RecentChanges(2, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"x", "three"},
+		[]string{recent[0].Summary, recent[1].Summary})
+
+	_, err = store.Load("Missing")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestS3ReadsIndexes(t *testing.T) {
+	store, fake := newTestS3(t)
+	start := time.Date(2022, 11, 5, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		err := store.Save(&types.Page{Title: "ABC", Body: []byte("body")},
+			&types.Revision{Summary: strconv.Itoa(i),
+				Timestamp: start.Add(time.Duration(i) * time.Minute)})
+		assert.Nil(t, err)
+	}
+
+	fake.gets = 0
+	history, err := store.History("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(history))
+	recent, err := store.RecentChanges(3, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "4", recent[0].Summary)
+	assert.Equal(t, 2, fake.gets)
+
+	// Buckets written before the indexes existed get them rebuilt.
+	delete(fake.objects, "team/history/ABC.json")
+	delete(fake.objects, "team/recent.json")
+	history, err = store.History("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(history))
+	assert.Nil(t, store.Save(&types.Page{Title: "ABC", Body: []byte("six")},
+		&types.Revision{Summary: "5", Timestamp: start.Add(time.Hour)}))
+	fake.gets = 0
+	history, _ = store.History("ABC")
+	recent, _ = store.RecentChanges(10, false)
+	assert.Equal(t, 6, len(history))
+	assert.Equal(t, 6, len(recent))
+	assert.Equal(t, 2, fake.gets)
+}
+
+func TestS3SaveDetectsConcurrentWrite(t *testing.T) {
+	store, fake := newTestS3(t)
+	store.Save(&types.Page{Title: "ABC", Body: []byte("one")},
+		&types.Revision{Timestamp: time.Now()})
+
+	fake.beforePut = func(key string) {
+		fake.beforePut = nil
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+		fake.objects[key] = fakeObject{body: []byte("theirs"), etag: "\"x\""}
+	}
+	err := store.Save(&types.Page{Title: "ABC", Body: []byte("mine")},
+		&types.Revision{Timestamp: time.Now()})
+	assert.True(t, errors.Is(err, ErrConflict))
+	page, _ := store.Load("ABC")
+	assert.Equal(t, "theirs", string(page.Body))
+}
+
+func TestNewS3RequiresBucket(t *testing.T) {
+	_, err := NewS3(types.S3{Endpoint: "http://localhost:9000"})
+	assert.NotNil(t, err)
+}
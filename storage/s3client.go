@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// s3Client speaks just enough of the S3 REST API for the S3 backend: GET,
+// conditional PUT and ListObjectsV2, signed with AWS Signature Version 4
+// and addressed path-style so it works with MinIO and other S3 clones.
+type s3Client struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+	Now       func() time.Time
+}
+
+type s3Object struct {
+	Body      []byte
+	ETag      string
+	VersionID string
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func hashHex(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode follows the SigV4 rules: everything but unreserved characters
+// is percent-encoded, and "/" is kept only in paths.
+func uriEncode(value string, path bool) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			builder.WriteByte(b)
+		case b == '/' && path:
+			builder.WriteByte(b)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, false)+"="+uriEncode(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func (self *s3Client) sign(request *http.Request, payload []byte) {
+	now := self.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", hashHex(payload))
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(
+			strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		uriEncode(request.URL.Path, true),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(payload)}, "\n")
+	scope := day + "/" + self.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+self.SecretKey), day)
+	key = hmacSHA256(key, self.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		self.AccessKey, scope, signedHeaders, signature))
+}
+
+func (self *s3Client) do(
+	method string,
+	key string,
+	query url.Values,
+	headers map[string]string,
+	payload []byte) (*http.Response, []byte, error) {
+	target, err := url.Parse(strings.TrimRight(self.Endpoint, "/") + "/" +
+		self.Bucket + "/" + key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if query != nil {
+		target.RawQuery = canonicalQuery(query)
+	}
+	request, err := http.NewRequest(method, target.String(),
+		bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	self.sign(request, payload)
+	response, err := self.Client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	return response, body, err
+}
+
+func s3Error(method string, key string, response *http.Response,
+	body []byte) error {
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return notFound(key)
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%s %s: %w", method, key, ErrPreconditionFailed)
+	default:
+		return fmt.Errorf("%s %s: %s: %s", method, key, response.Status,
+			strings.TrimSpace(string(body)))
+	}
+}
+
+func (self *s3Client) Get(key string) (*s3Object, error) {
+	response, body, err := self.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, s3Error(http.MethodGet, key, response, body)
+	}
+	return &s3Object{
+		Body:      body,
+		ETag:      response.Header.Get("ETag"),
+		VersionID: response.Header.Get("X-Amz-Version-Id")}, nil
+}
+
+// Put writes key. An empty ifMatch with create set only succeeds when the
+// key does not exist yet; a non-empty ifMatch only succeeds when the stored
+// ETag still matches. Either failure is ErrPreconditionFailed.
+func (self *s3Client) Put(
+	key string,
+	payload []byte,
+	ifMatch string,
+	create bool) (*s3Object, error) {
+	headers := map[string]string{}
+	if ifMatch != "" {
+		headers["If-Match"] = ifMatch
+	} else if create {
+		headers["If-None-Match"] = "*"
+	}
+	response, body, err := self.do(http.MethodPut, key, nil, headers, payload)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, s3Error(http.MethodPut, key, response, body)
+	}
+	return &s3Object{
+		ETag:      response.Header.Get("ETag"),
+		VersionID: response.Header.Get("X-Amz-Version-Id")}, nil
+}
+
+func (self *s3Client) Delete(key string) error {
+	response, body, err := self.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusNoContent &&
+		response.StatusCode != http.StatusOK {
+		return s3Error(http.MethodDelete, key, response, body)
+	}
+	return nil
+}
+
+func (self *s3Client) List(prefix string) ([]string, error) {
+	keys := []string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		response, body, err := self.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
+			return nil, s3Error(http.MethodGet, prefix, response, body)
+		}
+		var result s3ListResult
+		if err = xml.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+		if !result.IsTruncated {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+type Storage interface {
+	Titles() ([]string, error)
+	Load(title string) (*types.Page, error)
+	Save(page *types.Page, revision *types.Revision) error
+	Delete(title string, revision *types.Revision) error
+	History(title string) ([]types.Revision, error)
+	Revision(title string, number int) (*types.Page, error)
+	RecentChanges(limit int, hideMinor bool) ([]types.Revision, error)
+}
+
+func New(config *types.Config) (Storage, error) {
+	docRoot := config.Server.DocRoot
+	switch config.Storage.Backend {
+	case "", "filesystem":
+		return NewFilesystem(docRoot), nil
+	case "git":
+		return NewGit(docRoot)
+	case "bolt":
+		path := config.Storage.Path
+		if path == "" {
+			path = filepath.Join(docRoot, "wiki.db")
+		}
+		return NewBolt(path)
+	case "s3":
+		return NewS3(config.Storage.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q",
+			config.Storage.Backend)
+	}
+}
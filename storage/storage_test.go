@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSelectsBackend(t *testing.T) {
+	config := &types.Config{Server: types.Server{DocRoot: t.TempDir()}}
+	store, err := New(config)
+	assert.Nil(t, err)
+	assert.IsType(t, &Filesystem{}, store)
+
+	config.Storage.Backend = "git"
+	store, err = New(config)
+	assert.Nil(t, err)
+	assert.IsType(t, &Git{}, store)
+
+	config.Storage.Backend = "bolt"
+	store, err = New(config)
+	assert.Nil(t, err)
+	assert.IsType(t, &Bolt{}, store)
+	store.(*Bolt).Close()
+
+	config.Storage.Backend = "s3"
+	config.Storage.S3 = types.S3{Endpoint: "http://localhost:9000",
+		Bucket: "wiki"}
+	store, err = New(config)
+	assert.Nil(t, err)
+	assert.IsType(t, &S3{}, store)
+
+	config.Storage.Backend = "floppy"
+	_, err = New(config)
+	assert.NotNil(t, err)
+}
+
+func TestFilesystemRoundTrip(t *testing.T) {
+	store := NewFilesystem(t.TempDir())
+	err := store.Save(&types.Page{Title: "ABC", Body: []byte("one")},
+		&types.Revision{Summary: "Create", Timestamp: time.Now()})
+	assert.Nil(t, err)
+
+	page, err := store.Load("ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, "one", string(page.Body))
+	history, _ := store.History("ABC")
+	assert.Equal(t, 1, len(history))
+	recent, _ := store.RecentChanges(0, false)
+	assert.Equal(t, "Create", recent[0].Summary)
+	first, _ := store.Revision("ABC", 1)
+	assert.Equal(t, "one", string(first.Body))
+}
+
+func TestLoggedUsesLoggerAttributes(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(out,
+		&slog.HandlerOptions{Level: slog.LevelWarn})).With("request_id", "r1")
+	store := &Logged{Storage: NewFilesystem(t.TempDir()), Logger: logger}
+
+	// A missing page is routine, so it stays below warn.
+	_, err := store.Load("Missing")
+	assert.Error(t, err)
+	assert.Empty(t, out.String())
+
+	// A doc root that is a file is not.
+	root := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(root, nil, 0600))
+	store = &Logged{Storage: NewFilesystem(root), Logger: logger}
+	err = store.Save(&types.Page{Title: "Home"}, &types.Revision{})
+	assert.Error(t, err)
+	assert.Contains(t, out.String(), `"request_id":"r1"`)
+	assert.Contains(t, out.String(), `"operation":"save"`)
+}
+
+type errorCounter map[string]int
+
+func (self errorCounter) ObserveStorage(
+	operation string,
+	start time.Time,
+	err error) {
+	if err != nil {
+		self[operation]++
+	}
+}
+
+func TestInstrumentedIgnoresMissingPages(t *testing.T) {
+	root := t.TempDir()
+	failures := errorCounter{}
+	store := &Instrumented{Storage: NewFilesystem(root), Observer: failures}
+	_, err := store.Load("Missing")
+	assert.True(t, os.IsNotExist(err))
+	_, err = store.Revision("Missing", 1)
+	assert.NotNil(t, err)
+	assert.Empty(t, failures)
+
+	// A doc root that is a file fails for real.
+	file := filepath.Join(root, "file")
+	os.WriteFile(file, nil, 0600)
+	store.Storage = NewFilesystem(file)
+	store.Save(&types.Page{Title: "A"}, &types.Revision{})
+	assert.Equal(t, errorCounter{"save": 1}, failures)
+}
@@ -1,6 +1,11 @@
 package templates
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -15,70 +20,289 @@ import (
 type Templates struct {
 	Config    *types.Config
 	Templates *template.Template
+	Version   string
 }
 
-func (self Templates) writeViewTemplateToRootDir() (int, error) {
+var templateNames = []string{"view.html", "edit.html", "history.html",
+	"recent.html", "deliveries.html", "tags.html", "tag.html", "audit.html",
+	"moderation.html"}
+
+func (self Templates) writeTemplateToRootDir(
+	name string,
+	template string) (int, error) {
 	rootDir := self.Config.Server.DocRoot
-	viewTemplatePath := path.Join(rootDir, "view.html")
-	viewTemplateFile, err := os.Create(viewTemplatePath)
+	templatePath := path.Join(rootDir, name)
+	templateFile, err := os.Create(templatePath)
 	if err != nil {
-		log.Fatalf("Failed to create template html file %s", viewTemplatePath)
+		log.Fatalf("Failed to create template html file %s", templatePath)
 		return 0, err
 	} else {
-		template := `<h1>{{.Title}}</h1>
+		bytesCount, err := templateFile.WriteString(template)
+		defer templateFile.Close()
+		if err != nil {
+			return 0, err
+		}
+		return bytesCount, err
+	}
+}
+
+func (self Templates) writeViewTemplateToRootDir() (int, error) {
+	template := `<h1>{{.Title}}</h1>
 			<p>
 				<a href="/edit/{{.Title}}">
 					edit
 				</a>
 			</p>
+			{{if .Meta}}
+			<dl>
+				{{range $key, $value := .Meta}}
+				<dt>{{html $key}}</dt>
+				<dd>{{html (printf "%v" $value)}}</dd>
+				{{end}}
+			</dl>
+			{{end}}
 			<div>
 				{{printf "%s" .Body}}
 			</div>`
-		bytesCount, err := viewTemplateFile.WriteString(template)
-		defer viewTemplateFile.Close()
-		if err != nil {
-			return 0, err
-		}
-		return bytesCount, err
-	}
+	return self.writeTemplateToRootDir("view.html", template)
 }
 
 func (self Templates) writeEditTemplateToRootDir() (int, error) {
-	rootDir := self.Config.Server.DocRoot
-	editTemplatePath := path.Join(rootDir, "edit.html")
-	editTemplateFile, err := os.Create(editTemplatePath)
-	if err != nil {
-		log.Fatalf("Failed to create template html file %s", editTemplatePath)
-		return 0, err
-	} else {
-		template := `<h1>Editing {{.Title}}</h1>
+	template := `<h1>Editing {{.Title}}</h1>
 			<form action="/save/{{.Title}}" method="POST">
 				<div>
 					<textarea name="body" rows="20" cols="80">
-						{{printf "%s" .Body}}
+						{{html (printf "%s" .Body)}}
 					</textarea>
 				</div>
+				<div>
+					<label>
+						Summary
+						<input type="text" name="summary" size="60">
+					</label>
+					<label>
+						<input type="checkbox" name="minor">
+						This is a minor edit
+					</label>
+				</div>
+				<input type="hidden" name="section" value="{{.Section}}">
+				<input type="hidden" name="revision" value="{{.Revision}}">
+				<input type="hidden" name="started" value="{{.Started}}">
+				<div style="display:none">
+					<label>
+						Leave this empty
+						<input type="text" name="website" tabindex="-1"
+							autocomplete="off">
+					</label>
+				</div>
 				<div>
 					<input type="submit" value="Save">
+					<input type="submit" value="Preview"
+						formaction="/preview/{{.Title}}" formtarget="preview">
 				</div>
-			</form>`
-		bytesCount, err := editTemplateFile.WriteString(template)
-		defer editTemplateFile.Close()
-		if err != nil {
-			return 0, err
-		}
-		return bytesCount, err
-	}
+			</form>
+			<iframe name="preview" title="Preview"></iframe>`
+	return self.writeTemplateToRootDir("edit.html", template)
+}
+
+func (self Templates) writeHistoryTemplateToRootDir() (int, error) {
+	template := `<h1>History of {{.Title}}</h1>
+			<ul>
+				{{range .Revisions}}
+				<li>
+					r{{.Number}}
+					{{.Timestamp.Format "2006-01-02 15:04:05"}}
+					{{if .Minor}}<b>m</b>{{end}}
+					{{html .Author}}
+					{{html .Summary}}
+					<form action="/revert/{{$.Title}}" method="POST">
+						<input type="hidden" name="revision" value="{{.Number}}">
+						<input type="submit" value="Revert">
+					</form>
+				</li>
+				{{end}}
+			</ul>`
+	return self.writeTemplateToRootDir("history.html", template)
+}
+
+func (self Templates) writeRecentTemplateToRootDir() (int, error) {
+	template := `<h1>Recent changes</h1>
+			<p>
+				{{if .HideMinor}}
+				<a href="/recent">Show minor edits</a>
+				{{else}}
+				<a href="/recent?hideminor=1">Hide minor edits</a>
+				{{end}}
+			</p>
+			<ul>
+				{{range .Revisions}}
+				<li>
+					<a href="/view/{{.Title}}">{{.Title}}</a>
+					r{{.Number}}
+					{{.Timestamp.Format "2006-01-02 15:04:05"}}
+					{{if .Minor}}<b>m</b>{{end}}
+					{{html .Summary}}
+				</li>
+				{{end}}
+			</ul>`
+	return self.writeTemplateToRootDir("recent.html", template)
+}
+
+func (self Templates) writeDeliveriesTemplateToRootDir() (int, error) {
+	template := `<h1>Webhook deliveries</h1>
+			<table>
+				<tr>
+					<th>Time</th><th>Event</th><th>URL</th>
+					<th>Attempt</th><th>Status</th><th>Error</th>
+				</tr>
+				{{range .}}
+				<tr>
+					<td>{{.Timestamp.Format "2006-01-02 15:04:05"}}</td>
+					<td>{{.Event}}</td>
+					<td>{{html .URL}}</td>
+					<td>{{.Attempt}}{{if .GaveUp}} (gave up){{end}}</td>
+					<td>{{.StatusCode}}</td>
+					<td>{{html .Error}}</td>
+				</tr>
+				{{end}}
+			</table>`
+	return self.writeTemplateToRootDir("deliveries.html", template)
+}
+
+func (self Templates) writeTagsTemplateToRootDir() (int, error) {
+	template := `<h1>Tags</h1>
+			<ul>
+				{{range .}}
+				<li>
+					<a href="/tags/{{html .Tag}}">{{html .Tag}}</a> ({{.Count}})
+				</li>
+				{{end}}
+			</ul>`
+	return self.writeTemplateToRootDir("tags.html", template)
+}
+
+func (self Templates) writeTagTemplateToRootDir() (int, error) {
+	template := `<h1>Pages tagged {{html .Tag}}</h1>
+			<ul>
+				{{range .Titles}}
+				<li><a href="/view/{{.}}">{{.}}</a></li>
+				{{end}}
+			</ul>`
+	return self.writeTemplateToRootDir("tag.html", template)
+}
+
+func (self Templates) writeAuditTemplateToRootDir() (int, error) {
+	template := `<h1>Audit log</h1>
+			<form action="/admin/audit" method="GET">
+				<input type="text" name="user" value="{{html .User}}"
+					placeholder="User">
+				<input type="text" name="action" value="{{html .Action}}"
+					placeholder="Action">
+				<input type="text" name="title" value="{{html .Title}}"
+					placeholder="Title">
+				<input type="text" name="since" value="{{html .Since}}"
+					placeholder="Since (2006-01-02)">
+				<input type="submit" value="Filter">
+			</form>
+			{{if .ChainError}}
+			<p><strong>Hash chain broken: {{html .ChainError}}</strong></p>
+			{{else}}
+			<p>Hash chain verified.</p>
+			{{end}}
+			<table>
+				<tr>
+					<th>#</th><th>Time</th><th>User</th><th>IP</th>
+					<th>Action</th><th>Title</th><th>Revisions</th>
+				</tr>
+				{{range .Entries}}
+				<tr>
+					<td>{{.Sequence}}</td>
+					<td>{{.Timestamp.Format "2006-01-02 15:04:05"}}</td>
+					<td>{{html .User}}</td>
+					<td>{{html .IP}}</td>
+					<td>{{html .Action}}</td>
+					<td>{{html .Title}}</td>
+					<td>{{.OldRevision}} &rarr; {{.NewRevision}}</td>
+				</tr>
+				{{end}}
+			</table>`
+	return self.writeTemplateToRootDir("audit.html", template)
+}
+
+func (self Templates) writeModerationTemplateToRootDir() (int, error) {
+	template := `<h1>Held edits</h1>
+			{{if not .Held}}
+			<p>No edits are waiting for moderation.</p>
+			{{end}}
+			{{range .Held}}
+			<div>
+				<h2>{{.Title}}</h2>
+				<p>
+					{{.Received.Format "2006-01-02 15:04:05"}}
+					{{html .Author}}
+					{{html .Summary}}
+					{{if .Minor}}<b>m</b>{{end}}
+				</p>
+				<p>Held because: {{html .Reason}}</p>
+				<pre>{{html .Source}}</pre>
+				<form action="/admin/moderation/approve" method="POST">
+					<input type="hidden" name="id" value="{{.ID}}">
+					<input type="hidden" name="csrf" value="{{$.Token}}">
+					<input type="submit" value="Approve">
+				</form>
+				<form action="/admin/moderation/discard" method="POST">
+					<input type="hidden" name="id" value="{{.ID}}">
+					<input type="hidden" name="csrf" value="{{$.Token}}">
+					<input type="submit" value="Discard">
+				</form>
+			</div>
+			{{end}}`
+	return self.writeTemplateToRootDir("moderation.html", template)
+}
+
+func (self Templates) Render(tmpl string, data interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := self.Templates.ExecuteTemplate(&buffer, tmpl+".html", data)
+	return buffer.Bytes(), err
 }
 
 func (self Templates) RenderTemplate(
 	writter http.ResponseWriter,
 	tmpl string,
-	page *types.Page) {
-	err := self.Templates.ExecuteTemplate(writter, tmpl+".html", page)
+	data interface{}) {
+	body, err := self.Render(tmpl, data)
 	if err != nil {
 		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writter.Write(body)
+}
+
+// Check reports a template that failed to parse.
+func (self Templates) Check() error {
+	if self.Templates == nil {
+		return errors.New("templates have not been parsed")
+	}
+	for _, name := range templateNames {
+		if self.Templates.Lookup(name) == nil {
+			return fmt.Errorf("template %s has not been parsed", name)
+		}
 	}
+	return nil
+}
+
+// version identifies the template sources so cached responses can be told
+// apart after the templates change.
+func version(templatePaths []string) string {
+	hash := sha256.New()
+	for _, templatePath := range templatePaths {
+		content, err := os.ReadFile(templatePath)
+		if err != nil {
+			log.Fatalf("Failed to read template html file %s", templatePath)
+		}
+		hash.Write(content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
 }
 
 var templates *Templates = nil
@@ -90,11 +314,21 @@ func InstantiateTemplates(settingsFile string) *Templates {
 		templates = &Templates{Config: config, Templates: nil}
 		templates.writeEditTemplateToRootDir()
 		templates.writeViewTemplateToRootDir()
-		viewTemplatePath := path.Join(config.Server.DocRoot, "view.html")
-		editTemplatePath := path.Join(config.Server.DocRoot, "edit.html")
-		htmlTemplate := template.Must(
-			template.ParseFiles(viewTemplatePath, editTemplatePath))
+		templates.writeHistoryTemplateToRootDir()
+		templates.writeRecentTemplateToRootDir()
+		templates.writeDeliveriesTemplateToRootDir()
+		templates.writeTagsTemplateToRootDir()
+		templates.writeTagTemplateToRootDir()
+		templates.writeAuditTemplateToRootDir()
+		templates.writeModerationTemplateToRootDir()
+		templatePaths := []string{}
+		for _, name := range templateNames {
+			templatePaths = append(templatePaths,
+				path.Join(config.Server.DocRoot, name))
+		}
+		htmlTemplate := template.Must(template.ParseFiles(templatePaths...))
 		templates.Templates = htmlTemplate
+		templates.Version = version(templatePaths)
 	})
 	return templates
 }
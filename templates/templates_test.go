@@ -68,6 +68,7 @@ func TestInstantiateTemplates(t *testing.T) {
 	}
 	templates := InstantiateTemplates(settingsFile)
 	assert.NotNilf(t, templates, "Failed to instantiate templates.")
+	assert.Equal(t, 12, len(templates.Version))
 
 	templatePath := path.Join(*rootPath, "view.html")
 	content, err := util.LoadToString(templatePath)
@@ -80,6 +81,14 @@ func TestInstantiateTemplates(t *testing.T) {
 				edit
 			</a>
 		</p>
+		{{if .Meta}}
+		<dl>
+			{{range $key, $value := .Meta}}
+			<dt>{{html $key}}</dt>
+			<dd>{{html (printf "%v" $value)}}</dd>
+			{{end}}
+		</dl>
+		{{end}}
 		<div>
 			{{printf"%s".Body}}
 		</div>`)
@@ -95,13 +104,36 @@ func TestInstantiateTemplates(t *testing.T) {
 			<form action="/save/{{.Title}}" method="POST">
 				<div>
 					<textarea name="body" rows="20" cols="80">
-						{{printf "%s" .Body}}
+						{{html (printf "%s" .Body)}}
 					</textarea>
 				</div>
+				<div>
+					<label>
+						Summary
+						<input type="text" name="summary" size="60">
+					</label>
+					<label>
+						<input type="checkbox" name="minor">
+						This is a minor edit
+					</label>
+				</div>
+				<input type="hidden" name="section" value="{{.Section}}">
+				<input type="hidden" name="revision" value="{{.Revision}}">
+				<input type="hidden" name="started" value="{{.Started}}">
+				<div style="display:none">
+					<label>
+						Leave this empty
+						<input type="text" name="website" tabindex="-1"
+							autocomplete="off">
+					</label>
+				</div>
 				<div>
 					<input type="submit" value="Save">
+					<input type="submit" value="Preview"
+						formaction="/preview/{{.Title}}" formtarget="preview">
 				</div>
-			</form>`)
+			</form>
+			<iframe name="preview" title="Preview"></iframe>`)
 	assert.Equalf(t, expected, cleanString(content),
 		"Expected template \"\" != actual %s", content)
 }
@@ -1,14 +1,156 @@
 package types
 
+import "time"
+
 type Page struct {
 	Title string
 	Body  []byte
+	Meta  map[string]interface{}
+}
+
+type Revision struct {
+	Title     string    `json:"title"`
+	Number    int       `json:"number"`
+	Summary   string    `json:"summary"`
+	Minor     bool      `json:"minor"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EditForm is the edit template's data. Section is the section number
+// being edited, empty for the whole page, and Revision the page revision
+// the form was served from. Started is a signed stamp of when it was
+// served.
+type EditForm struct {
+	Title    string
+	Body     []byte
+	Section  string
+	Revision int
+	Started  string
+}
+
+type History struct {
+	Title     string
+	Revisions []Revision
+}
+
+type RecentChanges struct {
+	HideMinor bool
+	Revisions []Revision
+}
+
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+type TaggedPages struct {
+	Tag    string
+	Titles []string
+}
+
+// TLS serves HTTPS with Cert and Key, which are reloaded when they change.
+// SelfSigned generates them on first run, by default under
+// <doc_root>/.tls, for development. RedirectAddress is an optional plain
+// HTTP listener that redirects to HTTPS, and HSTSMaxAge a Go duration for
+// the Strict-Transport-Security header. HSTSIncludeSubdomains extends it to
+// every subdomain, which must then all serve HTTPS too.
+type TLS struct {
+	Cert                  string `yaml:"cert"`
+	Key                   string `yaml:"key"`
+	SelfSigned            bool   `yaml:"self_signed"`
+	RedirectAddress       string `yaml:"redirect_address"`
+	HSTSMaxAge            string `yaml:"hsts_max_age"`
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains"`
 }
 
 type Server struct {
 	DocRoot string `yaml:"doc_root"`
+	Address string `yaml:"address"`
+	TLS     TLS    `yaml:"tls"`
+}
+
+type Webhook struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"`
+	Events []string `yaml:"events"`
+}
+
+type S3 struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+type Storage struct {
+	Backend string `yaml:"backend"`
+	Path    string `yaml:"path"`
+	S3      S3     `yaml:"s3"`
+}
+
+// Cache sizes the rendered page cache. TTL is a Go duration after which a
+// cached page is rendered again; servers sharing S3 storage need it to see
+// each other's saves, so it defaults to a minute there.
+type Cache struct {
+	Size         int    `yaml:"size"`
+	TTL          string `yaml:"ttl"`
+	CacheControl string `yaml:"cache_control"`
+}
+
+type Log struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// Backup schedules archives into Dir every Interval (a Go duration such as
+// "24h"), keeping the newest Retain of them.
+type Backup struct {
+	Dir      string `yaml:"dir"`
+	Interval string `yaml:"interval"`
+	Retain   int    `yaml:"retain"`
+}
+
+// RateLimit allows Burst requests at once and PerMinute, which must be
+// positive, sustained from one client.
+type RateLimit struct {
+	PerMinute float64 `yaml:"per_minute"`
+	Burst     int     `yaml:"burst"`
+}
+
+// Limits caps request bodies on write endpoints and rates per endpoint,
+// keyed by the endpoint's name (save, preview, revert, ...).
+type Limits struct {
+	MaxBodyBytes int64                `yaml:"max_body_bytes"`
+	Rates        map[string]RateLimit `yaml:"rates"`
+}
+
+// Spam configures the filters anonymous edits pass before being saved.
+// MinimumTime is a Go duration such as "5s".
+type Spam struct {
+	MaxLinks        int      `yaml:"max_links"`
+	BlockedDomains  []string `yaml:"blocked_domains"`
+	BlockedPatterns []string `yaml:"blocked_patterns"`
+	MinimumTime     string   `yaml:"minimum_time"`
+}
+
+// Render configures page rendering. TOCThreshold is how many headings add
+// a table of contents without a [[_TOC_]] marker: 0 for the default,
+// negative for never.
+type Render struct {
+	TOCThreshold int `yaml:"toc_threshold"`
 }
 
 type Config struct {
-	Server Server `yaml:"server"`
+	Server   Server    `yaml:"server"`
+	Log      Log       `yaml:"log"`
+	Storage  Storage   `yaml:"storage"`
+	Cache    Cache     `yaml:"cache"`
+	Webhooks []Webhook `yaml:"webhooks"`
+	Backup   Backup    `yaml:"backup"`
+	Limits   Limits    `yaml:"limits"`
+	Spam     Spam      `yaml:"spam"`
+	Render   Render    `yaml:"render"`
 }
@@ -0,0 +1,150 @@
+package users
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	iterations = 600000
+	keyLength  = 32
+)
+
+var nameRegex = regexp.MustCompile("^[a-zA-Z0-9_.-]+$")
+
+var ErrExists = errors.New("user already exists")
+
+type User struct {
+	Name    string    `json:"name"`
+	Admin   bool      `json:"admin"`
+	Salt    string    `json:"salt"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+// Store keeps users in <root>/.users.json with PBKDF2-SHA256 password
+// hashes.
+type Store struct {
+	Path string
+
+	mutex sync.Mutex
+}
+
+func NewStore(root string) *Store {
+	return &Store{Path: filepath.Join(root, ".users.json")}
+}
+
+func (self *Store) load() (map[string]User, error) {
+	content, err := os.ReadFile(self.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]User{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	all := map[string]User{}
+	err = json.Unmarshal(content, &all)
+	return all, err
+}
+
+func (self *Store) save(all map[string]User) error {
+	content, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporary := self.Path + ".tmp"
+	if err = os.WriteFile(temporary, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporary, self.Path)
+}
+
+func hash(password string, salt []byte) (string, error) {
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, keyLength)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func (self *Store) Create(name string, password string, admin bool) error {
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("invalid user name %q", name)
+	}
+	if password == "" {
+		return errors.New("password must not be empty")
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	sum, err := hash(password, salt)
+	if err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	all, err := self.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := all[name]; ok {
+		return fmt.Errorf("%s: %w", name, ErrExists)
+	}
+	all[name] = User{Name: name, Admin: admin, Salt: hex.EncodeToString(salt),
+		Hash: sum, Created: time.Now().UTC()}
+	return self.save(all)
+}
+
+func (self *Store) List() ([]User, error) {
+	self.mutex.Lock()
+	all, err := self.load()
+	self.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	list := []User{}
+	for _, user := range all {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// Authenticate returns the user when password is theirs.
+func (self *Store) Authenticate(name string, password string) (*User, bool) {
+	self.mutex.Lock()
+	all, err := self.load()
+	self.mutex.Unlock()
+	if err != nil {
+		return nil, false
+	}
+	user, ok := all[name]
+	if !ok {
+		return nil, false
+	}
+	salt, err := hex.DecodeString(user.Salt)
+	if err != nil {
+		return nil, false
+	}
+	sum, err := hash(password, salt)
+	if err != nil ||
+		subtle.ConstantTimeCompare([]byte(sum), []byte(user.Hash)) != 1 {
+		return nil, false
+	}
+	return &user, true
+}
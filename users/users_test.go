@@ -0,0 +1,29 @@
+package users
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	store := NewStore(t.TempDir())
+	assert.NoError(t, store.Create("alice", "correct horse", true))
+	assert.True(t, errors.Is(store.Create("alice", "again", false), ErrExists))
+	assert.Error(t, store.Create("bad name", "secret", false))
+	assert.Error(t, store.Create("bob", "", false))
+
+	user, ok := store.Authenticate("alice", "correct horse")
+	assert.True(t, ok)
+	assert.True(t, user.Admin)
+	_, ok = store.Authenticate("alice", "wrong")
+	assert.False(t, ok)
+	_, ok = store.Authenticate("nobody", "correct horse")
+	assert.False(t, ok)
+
+	list, err := store.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.NotEqual(t, "correct horse", list[0].Hash)
+}
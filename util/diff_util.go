@@ -0,0 +1,88 @@
+package util
+
+import "strings"
+
+// maxDiffCells bounds the lines removed times the lines added that Diff
+// will compare, since the comparison needs memory for each pair.
+const maxDiffCells = 1 << 20
+
+// DiffTooLarge stands in for the changed lines of a diff that would cost
+// more than maxDiffCells to compute.
+const DiffTooLarge = "~ too many changed lines to compare\n"
+
+// Diff returns a line diff from before to after, each line prefixed with
+// "+" (added), "-" (removed) or " " (unchanged). Only the lines between
+// the common start and end are compared; when those are too many, they
+// are replaced by DiffTooLarge.
+func Diff(before string, after string) string {
+	a := splitLines(before)
+	b := splitLines(after)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var builder strings.Builder
+	for _, line := range a[:prefix] {
+		builder.WriteString(" " + line + "\n")
+	}
+	removed, added := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(removed) > 0 && len(added) > 0 &&
+		len(removed) > maxDiffCells/len(added) {
+		builder.WriteString(DiffTooLarge)
+	} else {
+		changes(&builder, removed, added)
+	}
+	for _, line := range a[len(a)-suffix:] {
+		builder.WriteString(" " + line + "\n")
+	}
+	return builder.String()
+}
+
+// changes writes the shortest diff from a to b to builder.
+func changes(builder *strings.Builder, a []string, b []string) {
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			builder.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			builder.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			builder.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	before := "one\ntwo\nthree\n"
+	after := "one\n2\nthree\nfour\n"
+	expected := " one\n-two\n+2\n three\n+four\n"
+	actual := Diff(before, after)
+	assert.Equalf(t, expected, actual, "Expected diff %q != actual %q",
+		expected, actual)
+}
+
+func TestDiffFromEmpty(t *testing.T) {
+	assert.Equal(t, "+one\n+two\n", Diff("", "one\ntwo"))
+	assert.Equal(t, "", Diff("", ""))
+}
+
+func TestDiffTooLarge(t *testing.T) {
+	var before, after strings.Builder
+	for i := 0; i < 1100; i++ {
+		before.WriteString("old " + strconv.Itoa(i) + "\n")
+		after.WriteString("new " + strconv.Itoa(i) + "\n")
+	}
+	assert.Equal(t, " head\n"+DiffTooLarge+" tail\n",
+		Diff("head\n"+before.String()+"tail\n",
+			"head\n"+after.String()+"tail\n"))
+	// Long pages with a small change are still compared line by line.
+	assert.Equal(t, " old 0\n-old 1\n+new 1\n old 2\n",
+		Diff("old 0\nold 1\nold 2\n", "old 0\nnew 1\nold 2\n"))
+}
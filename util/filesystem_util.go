@@ -2,30 +2,58 @@ package util
 
 import (
 	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mehoggan/simple-wiki-web-app-go/types"
 )
 
 func Save(page *types.Page, root string) error {
 	filename := filepath.Join(root, page.Title+".txt")
-	log.Printf("Writting page to %s...", filename)
-	return os.WriteFile(filename, page.Body, 0600)
+	source, err := Source(page)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, source, 0600)
 }
 
 func Load(title string, root string) (*types.Page, error) {
 	filename := filepath.Join(root, title+".txt")
-	log.Printf("Loading page from %s...", filename)
 	body, err := os.ReadFile(filename)
 	if err != nil {
-		log.Printf("Could not load page from %s with %s", filename, err)
 		return nil, err
 	} else {
-		return &types.Page{Title: title, Body: body}, nil
+		return parsePage(title, body), nil
+	}
+}
+
+func parsePage(title string, source []byte) *types.Page {
+	meta, body, err := ParseFrontMatter(source)
+	if err != nil {
+		slog.Warn("ignoring invalid front matter", "title", title,
+			"error", err)
 	}
+	return &types.Page{Title: title, Body: body, Meta: meta}
+}
+
+func Delete(title string, root string) error {
+	return os.Remove(filepath.Join(root, title+".txt"))
+}
+
+func Titles(root string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(root, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	titles := []string{}
+	for _, file := range files {
+		titles = append(titles, strings.TrimSuffix(filepath.Base(file), ".txt"))
+	}
+	return titles, nil
 }
 
 func LoadToString(source string) (string, error) {
@@ -53,13 +81,30 @@ func Copy(source string, destination string) (int64, error) {
 	return io.Copy(newFile, sourceFile)
 }
 
+// Writable reports why root cannot take new files, if it cannot.
+func Writable(root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+	probe, err := os.CreateTemp(root, ".writable-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
 func Exists(source string) bool {
 	if _, err := os.Stat(source); err == nil {
 		return true
 	} else if errors.Is(err, os.ErrNotExist) {
 		return false
 	} else {
-		log.Printf("Reporting %s does not exist with %s.", source, err)
+		slog.Warn("reporting file as missing", "path", source, "error", err)
 		return false
 	}
 }
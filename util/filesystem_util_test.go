@@ -110,3 +110,11 @@ func TestDoesNotExist(t *testing.T) {
 	saved := filepath.Join(rootPath, "TestPage.txt")
 	assert.Falsef(t, Exists(saved), "Saved %s reported to not exist.", saved)
 }
+
+func TestWritable(t *testing.T) {
+	rootPath := t.TempDir()
+	assert.NoError(t, Writable(rootPath))
+	assert.Error(t, Writable(filepath.Join(rootPath, "missing")))
+	entries, _ := os.ReadDir(rootPath)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+var frontMatterDelimiter = []byte("---")
+
+func nextLine(source []byte) ([]byte, []byte) {
+	end := bytes.IndexByte(source, '\n')
+	if end < 0 {
+		return bytes.TrimRight(source, "\r"), nil
+	}
+	return bytes.TrimRight(source[:end], "\r"), source[end+1:]
+}
+
+// yaml.v2 decodes nested mappings with interface{} keys, which neither
+// encoding/json nor templates handle well, so turn them into string keys.
+func normalizeYAML(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := map[string]interface{}{}
+		for key, element := range typed {
+			normalized[fmt.Sprint(key)] = normalizeYAML(element)
+		}
+		return normalized
+	case []interface{}:
+		for i, element := range typed {
+			typed[i] = normalizeYAML(element)
+		}
+		return typed
+	default:
+		return value
+	}
+}
+
+// ParseFrontMatter splits an optional leading YAML block delimited by "---"
+// lines from the rest of source.
+func ParseFrontMatter(
+	source []byte) (map[string]interface{}, []byte, error) {
+	first, rest := nextLine(source)
+	if !bytes.Equal(first, frontMatterDelimiter) {
+		return nil, source, nil
+	}
+
+	block := []byte{}
+	for rest != nil {
+		var line []byte
+		line, rest = nextLine(rest)
+		if bytes.Equal(line, frontMatterDelimiter) {
+			raw := map[string]interface{}{}
+			if err := yaml.Unmarshal(block, &raw); err != nil {
+				return nil, source, err
+			}
+			meta := map[string]interface{}{}
+			for key, value := range raw {
+				meta[key] = normalizeYAML(value)
+			}
+			if rest == nil {
+				rest = []byte{}
+			}
+			return meta, rest, nil
+		}
+		block = append(append(block, line...), '\n')
+	}
+	return nil, source, fmt.Errorf("front matter is missing a closing %s",
+		frontMatterDelimiter)
+}
+
+func Source(page *types.Page) ([]byte, error) {
+	if len(page.Meta) == 0 {
+		return page.Body, nil
+	}
+	block, err := yaml.Marshal(page.Meta)
+	if err != nil {
+		return nil, err
+	}
+	source := append([]byte("---\n"), block...)
+	source = append(source, "---\n"...)
+	return append(source, page.Body...), nil
+}
+
+func MetaStrings(page *types.Page, key string) []string {
+	switch value := page.Meta[key].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, element := range value {
+			values = append(values, fmt.Sprint(element))
+		}
+		return values
+	default:
+		return []string{}
+	}
+}
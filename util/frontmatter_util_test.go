@@ -0,0 +1,53 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	source := []byte("---\r\nowner: ops\r\ntags: [a, b]\r\nreview:\r\n" +
+		"  by: 2023-01-01\r\n---\r\nBody text.")
+	meta, body, err := ParseFrontMatter(source)
+	assert.Nil(t, err)
+	assert.Equal(t, "Body text.", string(body))
+	assert.Equal(t, "ops", meta["owner"])
+	assert.Equal(t, []interface{}{"a", "b"}, meta["tags"])
+	assert.Equal(t, map[string]interface{}{"by": "2023-01-01"}, meta["review"])
+}
+
+func TestParseFrontMatterAbsent(t *testing.T) {
+	source := []byte("Just a body.\n---\nwith a rule.")
+	meta, body, err := ParseFrontMatter(source)
+	assert.Nil(t, err)
+	assert.Nil(t, meta)
+	assert.Equal(t, source, body)
+}
+
+func TestParseFrontMatterInvalid(t *testing.T) {
+	_, _, err := ParseFrontMatter([]byte("---\nowner: ops\nBody."))
+	assert.NotNil(t, err)
+	_, _, err = ParseFrontMatter([]byte("---\n: [\n---\nBody."))
+	assert.NotNil(t, err)
+}
+
+func TestSaveAndLoadFrontMatter(t *testing.T) {
+	rootPath := t.TempDir()
+	page := &types.Page{Title: "TestPage", Body: []byte("Body.\n"),
+		Meta: map[string]interface{}{"owner": "ops",
+			"tags": []interface{}{"x"}}}
+	assert.Nil(t, Save(page, rootPath))
+
+	loaded, err := Load("TestPage", rootPath)
+	assert.Nil(t, err)
+	assert.Equal(t, page, loaded)
+	assert.Equal(t, []string{"x"}, PageTags(loaded))
+	assert.Equal(t, []string{"x"}, MetaStrings(loaded, "tags"))
+	assert.Equal(t, []string{"ops"}, MetaStrings(loaded, "owner"))
+	assert.Equal(t, []string{}, MetaStrings(loaded, "missing"))
+
+	loaded.Meta["tags"] = []interface{}{"Ops", "<script>x</script>", "a b"}
+	assert.Equal(t, []string{"ops"}, PageTags(loaded))
+}
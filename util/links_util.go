@@ -0,0 +1,23 @@
+package util
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Wiki links look like [[Title]], [[Title#Section]] or [[Title|label]].
+var linkRegex = regexp.MustCompile(`\[\[([a-zA-Z0-9]+)(#[^\]|]*)?(\|[^\]]*)?\]\]`)
+
+func ExtractLinks(body []byte) []string {
+	seen := map[string]bool{}
+	links := []string{}
+	for _, match := range linkRegex.FindAllSubmatch(body, -1) {
+		title := string(match[1])
+		if !seen[title] {
+			seen[title] = true
+			links = append(links, title)
+		}
+	}
+	sort.Strings(links)
+	return links
+}
@@ -0,0 +1,14 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractLinks(t *testing.T) {
+	body := []byte("See [[Runbook]], [[Oncall#Paging]], [[Runbook|the runbook]]" +
+		" and [[Tag:ops]] but not [[bad title]].")
+	assert.Equal(t, []string{"Oncall", "Runbook"}, ExtractLinks(body))
+	assert.Equal(t, []string{}, ExtractLinks([]byte("No links.")))
+}
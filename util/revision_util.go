@@ -0,0 +1,131 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+const revisionsDir = ".revisions"
+
+func revisionDir(title string, root string) string {
+	return filepath.Join(root, revisionsDir, title)
+}
+
+func historyFile(title string, root string) string {
+	return filepath.Join(revisionDir(title, root), "history.jsonl")
+}
+
+func SaveRevision(
+	page *types.Page,
+	revision *types.Revision,
+	root string) error {
+	history, err := LoadHistory(page.Title, root)
+	if err != nil {
+		return err
+	}
+	revision.Title = page.Title
+	revision.Number = len(history) + 1
+
+	if err = Save(page, root); err != nil {
+		return err
+	}
+	dir := revisionDir(page.Title, root)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	source, err := Source(page)
+	if err != nil {
+		return err
+	}
+	snapshot := filepath.Join(dir, strconv.Itoa(revision.Number)+".txt")
+	if err = os.WriteFile(snapshot, source, 0600); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(revision)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(historyFile(page.Title, root),
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func LoadHistory(title string, root string) ([]types.Revision, error) {
+	file, err := os.Open(historyFile(title, root))
+	if errors.Is(err, os.ErrNotExist) {
+		return []types.Revision{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	history := []types.Revision{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var revision types.Revision
+		if err := json.Unmarshal(scanner.Bytes(), &revision); err != nil {
+			return nil, err
+		}
+		history = append(history, revision)
+	}
+	return history, scanner.Err()
+}
+
+func LoadRevision(title string, number int, root string) (*types.Page, error) {
+	snapshot := filepath.Join(revisionDir(title, root),
+		strconv.Itoa(number)+".txt")
+	source, err := os.ReadFile(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return parsePage(title, source), nil
+}
+
+func LoadRecentChanges(
+	root string,
+	limit int,
+	hideMinor bool) ([]types.Revision, error) {
+	entries, err := os.ReadDir(filepath.Join(root, revisionsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return []types.Revision{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	recent := []types.Revision{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		history, err := LoadHistory(entry.Name(), root)
+		if err != nil {
+			return nil, err
+		}
+		for _, revision := range history {
+			if hideMinor && revision.Minor {
+				continue
+			}
+			recent = append(recent, revision)
+		}
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].Timestamp.After(recent[j].Timestamp)
+	})
+	if limit > 0 && len(recent) > limit {
+		recent = recent[:limit]
+	}
+	return recent, nil
+}
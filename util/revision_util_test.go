@@ -0,0 +1,85 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveRevision(t *testing.T) {
+	rootPath := t.TempDir()
+
+	page := &types.Page{Title: "TestPage", Body: []byte("First.")}
+	first := &types.Revision{Summary: "Create", Timestamp: time.Now()}
+	if err := SaveRevision(page, first, rootPath); err != nil {
+		t.Fatalf("Failed to save first revision with %s.", err)
+	}
+	page = &types.Page{Title: "TestPage", Body: []byte("Second.")}
+	second := &types.Revision{Summary: "Typo", Minor: true,
+		Timestamp: time.Now()}
+	if err := SaveRevision(page, second, rootPath); err != nil {
+		t.Fatalf("Failed to save second revision with %s.", err)
+	}
+
+	history, err := LoadHistory("TestPage", rootPath)
+	if err != nil {
+		t.Fatalf("Failed to load history with %s.", err)
+	}
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, 1, history[0].Number)
+	assert.Equal(t, "Create", history[0].Summary)
+	assert.False(t, history[0].Minor)
+	assert.Equal(t, 2, history[1].Number)
+	assert.Equal(t, "Typo", history[1].Summary)
+	assert.True(t, history[1].Minor)
+
+	current, err := Load("TestPage", rootPath)
+	if err != nil {
+		t.Fatalf("Failed to load current page with %s.", err)
+	}
+	assert.Equal(t, "Second.", string(current.Body))
+	older, err := LoadRevision("TestPage", 1, rootPath)
+	if err != nil {
+		t.Fatalf("Failed to load revision 1 with %s.", err)
+	}
+	assert.Equal(t, "First.", string(older.Body))
+}
+
+func TestLoadHistoryNoRevisions(t *testing.T) {
+	rootPath := t.TempDir()
+	history, err := LoadHistory("TestPage", rootPath)
+	assert.Nil(t, err)
+	assert.Empty(t, history)
+}
+
+func TestLoadRecentChanges(t *testing.T) {
+	rootPath := t.TempDir()
+	start := time.Now()
+
+	SaveRevision(&types.Page{Title: "A", Body: []byte("a")},
+		&types.Revision{Summary: "a1", Timestamp: start}, rootPath)
+	SaveRevision(&types.Page{Title: "B", Body: []byte("b")},
+		&types.Revision{Summary: "b1", Minor: true,
+			Timestamp: start.Add(time.Minute)}, rootPath)
+	SaveRevision(&types.Page{Title: "A", Body: []byte("aa")},
+		&types.Revision{Summary: "a2", Timestamp: start.Add(2 * time.Minute)},
+		rootPath)
+
+	recent, err := LoadRecentChanges(rootPath, 0, false)
+	if err != nil {
+		t.Fatalf("Failed to load recent changes with %s.", err)
+	}
+	summaries := []string{}
+	for _, revision := range recent {
+		summaries = append(summaries, revision.Summary)
+	}
+	assert.Equal(t, []string{"a2", "b1", "a1"}, summaries)
+
+	recent, _ = LoadRecentChanges(rootPath, 0, true)
+	assert.Equal(t, 2, len(recent))
+	recent, _ = LoadRecentChanges(rootPath, 1, false)
+	assert.Equal(t, 1, len(recent))
+	assert.Equal(t, "a2", recent[0].Summary)
+}
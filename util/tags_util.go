@@ -0,0 +1,140 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+var tagRegex = regexp.MustCompile(`\[\[Tag:([a-zA-Z0-9_-]+)\]\]`)
+var tagNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+var tagIndexMutex sync.Mutex
+
+func tagIndexFile(root string) string {
+	return filepath.Join(root, ".tags.json")
+}
+
+func ExtractTags(body []byte) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, match := range tagRegex.FindAllSubmatch(body, -1) {
+		tag := strings.ToLower(string(match[1]))
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// PageTags merges [[Tag:name]] markers in the body with a "tags" list in
+// the page's front matter. Front matter tags that a marker could not spell
+// are dropped.
+func PageTags(page *types.Page) []string {
+	tags := ExtractTags(page.Body)
+	for _, tag := range MetaStrings(page, "tags") {
+		if tagNameRegex.MatchString(tag) {
+			tags = append(tags, strings.ToLower(tag))
+		}
+	}
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+func LoadTagIndex(root string) (map[string][]string, error) {
+	content, err := os.ReadFile(tagIndexFile(root))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string][]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	index := map[string][]string{}
+	err = json.Unmarshal(content, &index)
+	return index, err
+}
+
+// BuildTagIndex maps each tag used by pages to the sorted titles using it.
+func BuildTagIndex(pages []*types.Page) map[string][]string {
+	index := map[string][]string{}
+	for _, page := range pages {
+		for _, tag := range PageTags(page) {
+			index[tag] = append(index[tag], page.Title)
+		}
+	}
+	for _, titles := range index {
+		sort.Strings(titles)
+	}
+	return index
+}
+
+func SaveTagIndex(index map[string][]string, root string) error {
+	content, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(tagIndexFile(root), content, 0600)
+}
+
+func removeTitle(titles []string, title string) []string {
+	kept := []string{}
+	for _, candidate := range titles {
+		if candidate != title {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
+
+func UpdateTagIndex(title string, tags []string, root string) error {
+	tagIndexMutex.Lock()
+	defer tagIndexMutex.Unlock()
+	index, err := LoadTagIndex(root)
+	if err != nil {
+		return err
+	}
+	for tag, titles := range index {
+		index[tag] = removeTitle(titles, title)
+		if len(index[tag]) == 0 {
+			delete(index, tag)
+		}
+	}
+	for _, tag := range tags {
+		index[tag] = append(index[tag], title)
+		sort.Strings(index[tag])
+	}
+	return SaveTagIndex(index, root)
+}
+
+func RebuildTagIndex(root string) error {
+	tagIndexMutex.Lock()
+	defer tagIndexMutex.Unlock()
+	titles, err := Titles(root)
+	if err != nil {
+		return err
+	}
+	pages := []*types.Page{}
+	for _, title := range titles {
+		page, err := Load(title, root)
+		if err != nil {
+			return err
+		}
+		pages = append(pages, page)
+	}
+	return SaveTagIndex(BuildTagIndex(pages), root)
+}
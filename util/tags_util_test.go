@@ -0,0 +1,42 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractTags(t *testing.T) {
+	body := []byte("Runbook [[Tag:ops]] and [[Tag:On-Call]] [[Tag:ops]] [[Tag:]]")
+	assert.Equal(t, []string{"on-call", "ops"}, ExtractTags(body))
+	assert.Equal(t, []string{}, ExtractTags([]byte("No tags here.")))
+}
+
+func TestUpdateTagIndex(t *testing.T) {
+	rootPath := t.TempDir()
+
+	assert.Nil(t, UpdateTagIndex("A", []string{"ops", "team"}, rootPath))
+	assert.Nil(t, UpdateTagIndex("B", []string{"ops"}, rootPath))
+	index, err := LoadTagIndex(rootPath)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{
+		"ops": {"A", "B"}, "team": {"A"}}, index)
+
+	// Retagging a page drops it from tags it no longer carries.
+	assert.Nil(t, UpdateTagIndex("A", []string{"docs"}, rootPath))
+	index, _ = LoadTagIndex(rootPath)
+	assert.Equal(t, map[string][]string{
+		"docs": {"A"}, "ops": {"B"}}, index)
+}
+
+func TestRebuildTagIndex(t *testing.T) {
+	rootPath := t.TempDir()
+	Save(&types.Page{Title: "A", Body: []byte("[[Tag:ops]]")}, rootPath)
+	Save(&types.Page{Title: "B", Body: []byte("[[Tag:ops]] [[Tag:x]]")},
+		rootPath)
+
+	assert.Nil(t, RebuildTagIndex(rootPath))
+	index, _ := LoadTagIndex(rootPath)
+	assert.Equal(t, map[string][]string{"ops": {"A", "B"}, "x": {"B"}}, index)
+}
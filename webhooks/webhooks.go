@@ -0,0 +1,379 @@
+package webhooks
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+)
+
+const (
+	PageCreated = "page.created"
+	PageUpdated = "page.updated"
+	PageRenamed = "page.renamed"
+	PageDeleted = "page.deleted"
+)
+
+const (
+	SignatureHeader = "X-Wiki-Signature"
+	EventHeader     = "X-Wiki-Event"
+	DeliveryHeader  = "X-Wiki-Delivery"
+)
+
+type Event struct {
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	OldTitle  string    `json:"old_title,omitempty"`
+	Revision  int       `json:"revision,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Delivery is one event queued for one hook. Hook is the hook's index in
+// Dispatcher.Hooks, since several hooks may share a URL.
+type Delivery struct {
+	ID          string    `json:"id"`
+	Hook        int       `json:"hook"`
+	URL         string    `json:"url"`
+	Event       string    `json:"event"`
+	Payload     []byte    `json:"payload"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+type LogEntry struct {
+	DeliveryID string    `json:"delivery_id"`
+	URL        string    `json:"url"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+	GaveUp     bool      `json:"gave_up,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type Dispatcher struct {
+	Hooks       []types.Webhook
+	Root        string
+	Client      *http.Client
+	MaxAttempts int
+	BaseDelay   time.Duration
+	Now         func() time.Time
+
+	// mutex guards the queue file; sending serialises ProcessDue, which
+	// does not hold mutex while it waits on receivers.
+	mutex   sync.Mutex
+	sending sync.Mutex
+	wake    chan struct{}
+}
+
+func NewDispatcher(hooks []types.Webhook, root string) *Dispatcher {
+	return &Dispatcher{
+		Hooks:       hooks,
+		Root:        filepath.Join(root, ".webhooks"),
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 8,
+		BaseDelay:   time.Second,
+		Now:         time.Now,
+		wake:        make(chan struct{}, 1)}
+}
+
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func Verify(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
+
+func newID() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(bytes)
+}
+
+func subscribed(hook types.Webhook, event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, candidate := range hook.Events {
+		if candidate == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Dispatcher) queueFile() string {
+	return filepath.Join(self.Root, "queue.json")
+}
+
+func (self *Dispatcher) logFile() string {
+	return filepath.Join(self.Root, "deliveries.jsonl")
+}
+
+func (self *Dispatcher) loadQueue() ([]Delivery, error) {
+	content, err := os.ReadFile(self.queueFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return []Delivery{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	queue := []Delivery{}
+	err = json.Unmarshal(content, &queue)
+	return queue, err
+}
+
+func (self *Dispatcher) saveQueue(queue []Delivery) error {
+	if err := os.MkdirAll(self.Root, 0700); err != nil {
+		return err
+	}
+	content, err := json.Marshal(queue)
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a truncated queue.
+	temporary := self.queueFile() + ".tmp"
+	if err = os.WriteFile(temporary, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporary, self.queueFile())
+}
+
+func (self *Dispatcher) appendLog(entry LogEntry) error {
+	if err := os.MkdirAll(self.Root, 0700); err != nil {
+		return err
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(self.logFile(),
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (self *Dispatcher) Fire(event Event) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = self.Now().UTC()
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	queue, err := self.loadQueue()
+	if err != nil {
+		return err
+	}
+	queued := false
+	for index, hook := range self.Hooks {
+		if !subscribed(hook, event.Type) {
+			continue
+		}
+		queue = append(queue, Delivery{
+			ID:          newID(),
+			Hook:        index,
+			URL:         hook.URL,
+			Event:       event.Type,
+			Payload:     payload,
+			NextAttempt: self.Now()})
+		queued = true
+	}
+	if !queued {
+		return nil
+	}
+	if err = self.saveQueue(queue); err != nil {
+		return err
+	}
+	select {
+	case self.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// secret is the secret of the hook a delivery was queued for. Deliveries
+// queued before they recorded their hook, or whose hook was since
+// reconfigured, fall back to the first hook with their URL.
+func (self *Dispatcher) secret(delivery Delivery) string {
+	if delivery.Hook >= 0 && delivery.Hook < len(self.Hooks) &&
+		self.Hooks[delivery.Hook].URL == delivery.URL {
+		return self.Hooks[delivery.Hook].Secret
+	}
+	for _, hook := range self.Hooks {
+		if hook.URL == delivery.URL {
+			return hook.Secret
+		}
+	}
+	return ""
+}
+
+func (self *Dispatcher) send(delivery Delivery) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, delivery.URL,
+		bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, delivery.ID)
+	request.Header.Set(SignatureHeader,
+		Sign(self.secret(delivery), delivery.Payload))
+	response, err := self.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode,
+			fmt.Errorf("receiver returned %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+func (self *Dispatcher) backoff(attempts int) time.Duration {
+	return self.BaseDelay * time.Duration(1<<uint(attempts-1))
+}
+
+func (self *Dispatcher) due() ([]Delivery, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	queue, err := self.loadQueue()
+	if err != nil {
+		return nil, err
+	}
+	due := []Delivery{}
+	for _, delivery := range queue {
+		if !delivery.NextAttempt.After(self.Now()) {
+			due = append(due, delivery)
+		}
+	}
+	return due, nil
+}
+
+// ProcessDue sends every delivery whose next attempt is due and returns how
+// many are still queued. The queue is only locked to pick deliveries and to
+// record how they went, so Fire never waits on a slow receiver.
+func (self *Dispatcher) ProcessDue() (int, error) {
+	self.sending.Lock()
+	defer self.sending.Unlock()
+	due, err := self.due()
+	if err != nil {
+		return 0, err
+	}
+
+	// attempted maps each sent delivery's ID to its retry, or to nil when
+	// it is done with.
+	attempted := map[string]*Delivery{}
+	for _, delivery := range due {
+		delivery.Attempts++
+		statusCode, err := self.send(delivery)
+		entry := LogEntry{
+			DeliveryID: delivery.ID,
+			URL:        delivery.URL,
+			Event:      delivery.Event,
+			Attempt:    delivery.Attempts,
+			StatusCode: statusCode,
+			Timestamp:  self.Now().UTC()}
+		attempted[delivery.ID] = nil
+		if err != nil {
+			entry.Error = err.Error()
+			if delivery.Attempts >= self.MaxAttempts {
+				entry.GaveUp = true
+			} else {
+				delivery.NextAttempt = self.Now().Add(
+					self.backoff(delivery.Attempts))
+				attempted[delivery.ID] = &delivery
+			}
+		}
+		if err := self.appendLog(entry); err != nil {
+			slog.Error("failed to log webhook delivery",
+				"delivery_id", delivery.ID, "error", err)
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	queue, err := self.loadQueue()
+	if err != nil {
+		return 0, err
+	}
+	remaining := []Delivery{}
+	for _, delivery := range queue {
+		retry, ok := attempted[delivery.ID]
+		if !ok {
+			remaining = append(remaining, delivery)
+		} else if retry != nil {
+			remaining = append(remaining, *retry)
+		}
+	}
+	return len(remaining), self.saveQueue(remaining)
+}
+
+func (self *Dispatcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(self.BaseDelay)
+	defer ticker.Stop()
+	for {
+		if _, err := self.ProcessDue(); err != nil {
+			slog.Error("failed to process webhook queue", "error", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-self.wake:
+		}
+	}
+}
+
+func (self *Dispatcher) LoadLog(limit int) ([]LogEntry, error) {
+	file, err := os.Open(self.logFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return []LogEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []LogEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	// Newest first.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, scanner.Err()
+}
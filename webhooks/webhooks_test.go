@@ -0,0 +1,193 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mehoggan/simple-wiki-web-app-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type receiver struct {
+	mutex    sync.Mutex
+	failures int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (self *receiver) ServeHTTP(
+	writter http.ResponseWriter,
+	request *http.Request) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	body, _ := ioutil.ReadAll(request.Body)
+	self.bodies = append(self.bodies, body)
+	self.headers = append(self.headers, request.Header.Clone())
+	if self.failures > 0 {
+		self.failures--
+		writter.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	writter.WriteHeader(http.StatusNoContent)
+}
+
+func TestFireDeliversSignedPayload(t *testing.T) {
+	receiver := &receiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	hooks := []types.Webhook{{URL: server.URL, Secret: "s3cret"}}
+	dispatcher := NewDispatcher(hooks, t.TempDir())
+	err := dispatcher.Fire(Event{Type: PageCreated, Title: "ABC", Revision: 1})
+	assert.Nil(t, err)
+	remaining, err := dispatcher.ProcessDue()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, remaining)
+
+	assert.Equal(t, 1, len(receiver.bodies))
+	var event Event
+	if err = json.Unmarshal(receiver.bodies[0], &event); err != nil {
+		t.Fatalf("Receiver got invalid JSON %s.", receiver.bodies[0])
+	}
+	assert.Equal(t, PageCreated, event.Type)
+	assert.Equal(t, "ABC", event.Title)
+	assert.Equal(t, PageCreated, receiver.headers[0].Get(EventHeader))
+	assert.True(t, Verify("s3cret", receiver.bodies[0],
+		receiver.headers[0].Get(SignatureHeader)))
+	assert.False(t, Verify("wrong", receiver.bodies[0],
+		receiver.headers[0].Get(SignatureHeader)))
+
+	entries, err := dispatcher.LoadLog(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, http.StatusNoContent, entries[0].StatusCode)
+}
+
+func TestFireOnlySubscribedEvents(t *testing.T) {
+	receiver := &receiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	hooks := []types.Webhook{{URL: server.URL, Events: []string{PageDeleted}}}
+	dispatcher := NewDispatcher(hooks, t.TempDir())
+	dispatcher.Fire(Event{Type: PageUpdated, Title: "ABC"})
+	dispatcher.ProcessDue()
+	assert.Equal(t, 0, len(receiver.bodies))
+}
+
+func TestRetriesWithBackoffAndPersistence(t *testing.T) {
+	receiver := &receiver{failures: 2}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	root := t.TempDir()
+	now := time.Date(2022, 11, 5, 12, 0, 0, 0, time.UTC)
+	hooks := []types.Webhook{{URL: server.URL, Secret: "s3cret"}}
+	dispatcher := NewDispatcher(hooks, root)
+	dispatcher.Now = func() time.Time { return now }
+	dispatcher.Fire(Event{Type: PageUpdated, Title: "ABC"})
+
+	remaining, _ := dispatcher.ProcessDue()
+	assert.Equal(t, 1, remaining)
+	// Not due yet: the first retry waits BaseDelay.
+	remaining, _ = dispatcher.ProcessDue()
+	assert.Equal(t, 1, len(receiver.bodies))
+
+	// A fresh dispatcher over the same root picks up the queue.
+	dispatcher = NewDispatcher(hooks, root)
+	now = now.Add(time.Second)
+	dispatcher.Now = func() time.Time { return now }
+	remaining, _ = dispatcher.ProcessDue()
+	assert.Equal(t, 1, remaining)
+	assert.Equal(t, 2, len(receiver.bodies))
+
+	// The second retry waits twice as long.
+	now = now.Add(time.Second)
+	remaining, _ = dispatcher.ProcessDue()
+	assert.Equal(t, 2, len(receiver.bodies))
+	now = now.Add(time.Second)
+	remaining, _ = dispatcher.ProcessDue()
+	assert.Equal(t, 0, remaining)
+	assert.Equal(t, 3, len(receiver.bodies))
+
+	entries, _ := dispatcher.LoadLog(0)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, 3, entries[0].Attempt)
+	assert.Equal(t, "", entries[0].Error)
+	assert.Equal(t, http.StatusServiceUnavailable, entries[2].StatusCode)
+}
+
+func TestGivesUpAfterMaxAttempts(t *testing.T) {
+	receiver := &receiver{failures: 10}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	dispatcher := NewDispatcher([]types.Webhook{{URL: server.URL}},
+		t.TempDir())
+	dispatcher.MaxAttempts = 2
+	dispatcher.BaseDelay = 0
+	dispatcher.Fire(Event{Type: PageUpdated, Title: "ABC"})
+	dispatcher.ProcessDue()
+	remaining, _ := dispatcher.ProcessDue()
+	assert.Equal(t, 0, remaining)
+
+	entries, _ := dispatcher.LoadLog(1)
+	assert.Equal(t, 1, len(entries))
+	assert.True(t, entries[0].GaveUp)
+}
+
+func TestHooksSharingAURLKeepTheirSecrets(t *testing.T) {
+	receiver := &receiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	dispatcher := NewDispatcher([]types.Webhook{
+		{URL: server.URL, Secret: "first"},
+		{URL: server.URL, Secret: "second"}}, t.TempDir())
+	dispatcher.Fire(Event{Type: PageUpdated, Title: "ABC"})
+	dispatcher.ProcessDue()
+
+	assert.Equal(t, 2, len(receiver.bodies))
+	for i, secret := range []string{"first", "second"} {
+		assert.True(t, Verify(secret, receiver.bodies[i],
+			receiver.headers[i].Get(SignatureHeader)), secret)
+	}
+}
+
+func TestFireDoesNotWaitForSends(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writter http.ResponseWriter, request *http.Request) {
+			started <- struct{}{}
+			<-release
+		}))
+	defer server.Close()
+
+	dispatcher := NewDispatcher([]types.Webhook{{URL: server.URL}},
+		t.TempDir())
+	dispatcher.Fire(Event{Type: PageUpdated, Title: "Slow"})
+	processed := make(chan int)
+	go func() {
+		remaining, _ := dispatcher.ProcessDue()
+		processed <- remaining
+	}()
+	<-started
+
+	fired := make(chan error)
+	go func() { fired <- dispatcher.Fire(Event{Type: PageUpdated}) }()
+	select {
+	case err := <-fired:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Fire waited for a delivery in flight.")
+	}
+	close(release)
+	// The sent delivery is done; the one fired meanwhile is still queued.
+	assert.Equal(t, 1, <-processed)
+}